@@ -14,7 +14,7 @@ func main() {
 	Model.GetConfig()
 	Utils.InitLogger(&Model.GetConfig().LoggerLevel)
 
-	c := make(chan os.Signal)
+	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	go func() {
 		<-c
@@ -23,7 +23,15 @@ func main() {
 
 	cmds := []*cobra.Command{
 		Commands.BackupCommand(),
+		Commands.InitCommand(),
+		Commands.DrillCommand(),
+		Commands.SnapshotsCommand(),
+		Commands.StatusCommand(),
+		Commands.FreshnessCommand(),
+		Commands.HistoryCommand(),
 		Commands.HelperCommand(),
+		Commands.ConfigCommand(),
+		Commands.ExclusionsCommand(),
 	}
 
 	var rootCmd = Commands.RootCommand()
@@ -0,0 +1,155 @@
+// Package gobackup runs the backup jobs of a configuration from another Go
+// program. Each Manager has its own configuration, logger and notifiers, the
+// errors are returned and never end the process.
+package gobackup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"gobackup/src/Model"
+	"gobackup/src/Services"
+	"gobackup/src/Utils"
+	"os"
+)
+
+type Config = Model.Config
+
+// Executor runs the commands of the jobs, see Utils.NewScriptedExecutor to test a pipeline without restic.
+type Executor = Utils.Executor
+
+type Manager struct {
+	config       *Config
+	logger       logrus.FieldLogger
+	notifiers    []Notifier
+	notifiersSet bool
+	dryRun       bool
+	host         string
+	executor     Executor
+}
+
+type Option func(*Manager)
+
+// WithLogger sends the logs of the manager to the logger, instead of the logger of the command line.
+func WithLogger(logger logrus.FieldLogger) Option {
+	return func(m *Manager) {
+		m.logger = logger
+	}
+}
+
+// WithNotifiers replaces the notifiers, by default the email report when it is enabled.
+func WithNotifiers(notifiers ...Notifier) Option {
+	return func(m *Manager) {
+		m.notifiers = notifiers
+		m.notifiersSet = true
+	}
+}
+
+// WithPassword gives the restic password, by default the RESTIC_PASSWORD environment variable.
+func WithPassword(password string) Option {
+	return func(m *Manager) {
+		m.config.ResticPassword = password
+	}
+}
+
+// WithExecutor runs the commands of every job with the executor, instead of the executor of the configuration.
+func WithExecutor(executor Executor) Option {
+	return func(m *Manager) {
+		m.executor = executor
+	}
+}
+
+// WithDryRun simulates the runs, see the --dry-run flag of the backup command.
+func WithDryRun(dryRun bool) Option {
+	return func(m *Manager) {
+		m.dryRun = dryRun
+	}
+}
+
+// WithHost records the snapshots under this host name, see the --host flag of the backup command.
+func WithHost(host string) Option {
+	return func(m *Manager) {
+		m.host = host
+	}
+}
+
+// LoadConfig reads and validates the configuration files or directories.
+func LoadConfig(paths ...string) (*Config, error) {
+	config := &Config{}
+	if err := config.LoadBackupConfig(paths...); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func New(config *Config, opts ...Option) (*Manager, error) {
+	if config == nil || config.BackupConfig == nil {
+		return nil, errors.New("a loaded configuration is required")
+	}
+	managerConfig := *config
+	m := &Manager{config: &managerConfig}
+	if managerConfig.ResticPassword == "" {
+		managerConfig.ResticPassword = os.Getenv("RESTIC_PASSWORD")
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if m.logger == nil {
+		m.logger = logrus.StandardLogger()
+	}
+	if !m.notifiersSet && config.BackupConfig.Email.Enabled {
+		email, err := NewEmailNotifier(config)
+		if err != nil {
+			return nil, err
+		}
+		email.server.Logger = m.logger
+		m.notifiers = []Notifier{email}
+	}
+	if m.config.ResticPassword == "" {
+		return nil, errors.New("the restic password is required")
+	}
+	return m, nil
+}
+
+// Run backs up the job of the configuration. The error is an *Error when the
+// backup failed or when a notification couldn't be sent, the report is
+// complete in both cases.
+func (m *Manager) Run(ctx context.Context, jobName string) (Report, error) {
+	job, err := m.config.BackupConfig.FindJob(jobName)
+	if err != nil {
+		return failedReport(jobName, Utils.ExitConfig), &Error{Code: Utils.ExitConfig, Err: err}
+	}
+	for _, folder := range job.Folders {
+		if _, err := os.Stat(folder); err != nil {
+			return failedReport(jobName, Utils.ExitPreflight), &Error{Code: Utils.ExitPreflight, Err: err}
+		}
+	}
+
+	bm := Services.NewBackupManager(m.config, job, m.logger.WithField("job", job.Name))
+	bm.DryRun = m.dryRun
+	bm.Host = m.host
+	if m.executor != nil {
+		bm.Executor = m.executor
+	}
+	report := newReport(bm, bm.Run(ctx))
+
+	var notifyErrors []error
+	if !m.dryRun {
+		for _, notifier := range m.notifiers {
+			if err := notifier.Notify(ctx, report); err != nil {
+				m.logger.WithField("job", job.Name).Error("Notification failed: ", err)
+				notifyErrors = append(notifyErrors, err)
+			}
+		}
+	}
+
+	if report.ExitCode != Utils.ExitSuccess && report.Status == Services.Failed {
+		return report, &Error{Code: report.ExitCode, Step: report.FailedStep, Err: fmt.Errorf("step %s failed", report.FailedStep)}
+	}
+	if len(notifyErrors) > 0 {
+		report.ExitCode = Utils.ExitNotification
+		return report, &Error{Code: Utils.ExitNotification, Err: notifyErrors[0]}
+	}
+	return report, nil
+}
@@ -0,0 +1,50 @@
+package gobackup
+
+import (
+	"context"
+	"gobackup/src/Services"
+)
+
+// Notifier receives the report of each run.
+type Notifier interface {
+	Notify(ctx context.Context, report Report) error
+}
+
+type NotifierFunc func(ctx context.Context, report Report) error
+
+func (f NotifierFunc) Notify(ctx context.Context, report Report) error {
+	return f(ctx, report)
+}
+
+// EmailNotifier sends the email report of the configuration.
+type EmailNotifier struct {
+	server *Services.EmailServer
+	from   string
+	to     string
+	attach bool
+}
+
+func NewEmailNotifier(config *Config) (*EmailNotifier, error) {
+	server, err := Services.NewEmailServer(config)
+	if err != nil {
+		return nil, err
+	}
+	return &EmailNotifier{
+		server: server,
+		from:   config.BackupConfig.Email.Sender,
+		to:     config.BackupConfig.Email.To,
+		attach: config.BackupConfig.Output.Attach,
+	}, nil
+}
+
+func (n *EmailNotifier) Notify(ctx context.Context, report Report) error {
+	mail := &Services.Email{
+		From: n.from,
+		To:   n.to,
+		Body: "Subject: " + report.Subject + "\n\n" + report.Body,
+	}
+	if n.attach {
+		mail.Attachments = report.OutputFiles
+	}
+	return n.server.Send(mail)
+}
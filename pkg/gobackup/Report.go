@@ -0,0 +1,93 @@
+package gobackup
+
+import (
+	"fmt"
+	"gobackup/src/Services"
+	"gobackup/src/Utils"
+	"strings"
+	"time"
+)
+
+type Status = Services.BackupStatus
+
+const (
+	Success = Services.Success
+	Failed  = Services.Failed
+	Warning = Services.Warning
+)
+
+type Step = Services.BackupStepResult
+
+type Report struct {
+	Job        string
+	Repository string
+	Status     Status
+	// ExitCode is the exit code of the backup command for this run
+	ExitCode   int
+	FailedStep string
+	StartTime  time.Time
+	Duration   time.Duration
+	Steps      []Step
+	Stats      *Utils.ResticStats
+	// Metrics are in the Prometheus text format
+	Metrics []string
+	// Subject and Body are the email report
+	Subject string
+	Body    string
+	// OutputFiles are the whole outputs of the commands with skipped lines
+	OutputFiles []string
+}
+
+func newReport(bm *Services.BackupManager, status Status) Report {
+	report := Report{
+		Job:         bm.Job.Name,
+		Repository:  bm.Job.Repository,
+		Status:      status,
+		ExitCode:    bm.ExitCode(),
+		StartTime:   bm.StartTime,
+		Duration:    time.Since(bm.StartTime),
+		Steps:       bm.StepResults,
+		Stats:       bm.GetResticStats(),
+		Metrics:     *bm.GetMetrics(),
+		OutputFiles: bm.OutputFiles,
+	}
+	for _, step := range bm.StepResults {
+		if step.Status == Failed {
+			report.FailedStep = step.ShortName
+			break
+		}
+	}
+	report.Subject, report.Body = splitEmail(bm.MakeEmailBody())
+	return report
+}
+
+// failedReport is the report of a job which couldn't start.
+func failedReport(job string, code int) Report {
+	return Report{Job: job, Status: Failed, ExitCode: code, StartTime: time.Now()}
+}
+
+// splitEmail separates the subject header of the email body from the text.
+func splitEmail(body string) (string, string) {
+	parts := strings.SplitN(body, "\n\n", 2)
+	if len(parts) != 2 || !strings.HasPrefix(parts[0], "Subject: ") {
+		return "", body
+	}
+	return strings.TrimPrefix(parts[0], "Subject: "), parts[1]
+}
+
+// Error is returned by Run when the backup failed, Code is the exit code of
+// the backup command for the same failure.
+type Error struct {
+	Code int
+	// Step is the short name of the failed step, empty when the job didn't start
+	Step string
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("backup failed (exit code %d): %s", e.Code, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
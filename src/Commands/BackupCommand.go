@@ -1,6 +1,8 @@
 package Commands
 
 import (
+	"context"
+	"errors"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	"gobackup/src/Model"
@@ -13,67 +15,112 @@ func BackupCommand() *cobra.Command {
 	bc := &cobra.Command{
 		Use:   "backup",
 		Short: "Backup with restic",
-		Long:  "Backup with restic, list of folders to backup in argument",
-		Args:  cobra.MinimumNArgs(1),
+		Long:  "Backup with restic, list of folders to backup in argument, or a job from the configuration",
+		Args:  cobra.ArbitraryArgs,
 		Run:   RunBackup,
 	}
 
 	bc.Flags().StringP("repo", "r", "", "Restic repository name")
+	bc.Flags().StringP("job", "j", "", "Job name from the configuration")
 	bc.Flags().String("metrics-file", "backup.prom", "Export metrics file as Prometheus format")
+	bc.Flags().Bool("dry-run", false, "Show the commands without modifying anything, only restic backup and forget are run with --dry-run")
+	bc.Flags().Bool("notify", false, "Send the email report in dry-run mode")
+	bc.Flags().String("host", "", "Host name of the snapshots, replaces the host of the job")
 
 	return bc
 }
 
 func RunBackup(cmd *cobra.Command, args []string) {
 	var repositoryName string
+	var jobName string
 	var folders = args
 	var metricsFilename string
+	var host string
+	var dryRun, notify bool
 	cmd.Flags().VisitAll(func(flag *pflag.Flag) {
 		switch flag.Name {
 		case "repo":
 			repositoryName = flag.Value.String()
+		case "job":
+			jobName = flag.Value.String()
 		case "metrics-file":
 			metricsFilename = flag.Value.String()
+		case "dry-run":
+			dryRun = flag.Value.String() == "true"
+		case "notify":
+			notify = flag.Value.String() == "true"
+		case "host":
+			host = flag.Value.String()
 		default:
 			break
 		}
 	})
 
-	Model.GetConfig().GetResticPassword()
-
-	err := _checkIfFoldersExists(folders)
-	Utils.HaltOnError(Utils.GetLogger(), err, "")
+	job, err := _resolveJob(jobName, repositoryName, folders)
+	Utils.HaltWithCode(Utils.GetLogger(), err, "", Utils.ExitConfig)
 
 	email, err := Services.NewEmailServer(Model.GetConfig())
-	Utils.HaltOnError(Utils.GetLogger(), err, "")
+	Utils.HaltWithCode(Utils.GetLogger(), err, "", Utils.ExitConfig)
+
+	Model.GetConfig().GetResticPassword()
+
+	err = _checkIfFoldersExists(job.Folders)
+	Utils.HaltWithCode(Utils.GetLogger(), err, "", Utils.ExitPreflight)
 
-	Services.InitBackupManager(Model.GetConfig(), repositoryName, folders)
+	startRunLog(job, dryRun)
+	Services.InitBackupManager(Model.GetConfig(), job)
 	bm := Services.GetBackupManager()
-	_, err = bm.ExecutePreCommand()
-	Utils.WarnOnError(Utils.GetLogger(), err, "Error during Pre-Command", nil)
-	bm.InitRepo()
-	bm.StartBackup()
-	bm.Cleanup()
-	bm.CheckRepoIntegrity()
-	_, err = bm.ExecutePostCommand()
-	Utils.WarnOnError(Utils.GetLogger(), err, "Error during Pre-Command", nil)
-	bm.GetResults()
-	if metricsFilename != "" {
+	bm.DryRun = dryRun
+	bm.Host = host
+	bm.Run(context.Background())
+	err = _report(bm, email, metricsFilename, !dryRun || notify)
+
+	exitCode := bm.ExitCode()
+	if exitCode == Utils.ExitSuccess && err != nil {
+		exitCode = Utils.ExitNotification
+	}
+	os.Exit(exitCode)
+}
+
+// _report exports the metrics and sends the email report of the run, the
+// error is set when the email can't be sent.
+func _report(bm *Services.BackupManager, email *Services.EmailServer, metricsFilename string, notify bool) error {
+	if metricsFilename != "" && !bm.DryRun {
 		metrics := bm.GetMetrics()
 		err := Utils.ExportMetricsToFile(metricsFilename, metrics)
 		Utils.WarnOnError(Utils.GetLogger(), err, "Error while exporting metrics to prometheus", nil)
 	}
-	if Model.GetConfig().BackupConfig.Email.Enabled {
+	if Model.GetConfig().BackupConfig.Email.Enabled && notify {
 		body := bm.MakeEmailBody()
 		mail := &Services.Email{
 			From: Model.GetConfig().BackupConfig.Email.Sender,
 			To:   Model.GetConfig().BackupConfig.Email.To,
 			Body: body,
 		}
+		if Model.GetConfig().BackupConfig.Output.Attach {
+			mail.Attachments = bm.OutputFiles
+		}
 		if err := email.Send(mail); err != nil {
 			Utils.GetLogger().Error("Email can't be send !", err.Error())
+			return err
+		}
+	}
+	return nil
+}
+
+// _resolveJob returns the configured job, or a job made of the repository
+// and folders given on the command line.
+func _resolveJob(jobName string, repositoryName string, folders []string) (*Model.Job, error) {
+	if jobName == "" {
+		if len(folders) == 0 {
+			return nil, errors.New("folders to backup or a job (--job) are required")
 		}
+		return &Model.Job{Name: repositoryName, Repository: repositoryName, Folders: folders}, nil
+	}
+	if repositoryName != "" || len(folders) > 0 {
+		return nil, errors.New("the repository and folders can't be given with a job")
 	}
+	return Model.GetConfig().BackupConfig.FindJob(jobName)
 }
 
 func _checkIfFoldersExists(folders []string) error {
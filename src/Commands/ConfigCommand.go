@@ -0,0 +1,74 @@
+package Commands
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"gobackup/src/Model"
+	"gobackup/src/Utils"
+	"gopkg.in/yaml.v2"
+	"os"
+	"strings"
+)
+
+func ConfigCommand() *cobra.Command {
+	cc := &cobra.Command{
+		Use:   "config",
+		Short: "Configuration helper command",
+		Long:  "Configuration helper command, validate or display the configuration file",
+		// The configuration is loaded by each sub command, to report errors instead of halting
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+	}
+
+	cc.AddCommand(&cobra.Command{
+		Use:   "validate",
+		Short: "Validate the configuration file",
+		Long:  "Validate the configuration file and print every error found",
+		Args:  cobra.NoArgs,
+		Run:   RunConfigValidate,
+	})
+	cc.AddCommand(&cobra.Command{
+		Use:   "show",
+		Short: "Show the effective configuration",
+		Long:  "Show the effective configuration, with defaults applied and secrets masked",
+		Args:  cobra.NoArgs,
+		Run:   RunConfigShow,
+	})
+
+	return cc
+}
+
+func RunConfigValidate(cmd *cobra.Command, args []string) {
+	paths := configPaths(cmd)
+	Model.GetConfig().Offline = true
+	err := Model.GetConfig().LoadBackupConfig(paths...)
+	if err == nil {
+		fmt.Printf("Configuration '%s' is valid\n", strings.Join(paths, "', '"))
+		return
+	}
+
+	if errs, ok := err.(Model.ValidationErrors); ok {
+		_, _ = fmt.Fprintf(os.Stderr, "Configuration '%s' has %d error(s):\n", strings.Join(paths, "', '"), len(errs))
+		for _, e := range errs {
+			_, _ = fmt.Fprintln(os.Stderr, "- "+e.Error())
+		}
+	} else {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+	}
+	os.Exit(Utils.ExitConfig)
+}
+
+func RunConfigShow(cmd *cobra.Command, args []string) {
+	paths := configPaths(cmd)
+	Model.GetConfig().Offline = true
+	err := Model.GetConfig().LoadBackupConfig(paths...)
+	if Model.GetConfig().BackupConfig == nil {
+		Utils.HaltOnError(Utils.GetLogger(), err, "Impossible to load configuration '"+strings.Join(paths, "', '")+"'")
+	}
+	Utils.WarnOnError(Utils.GetLogger(), err, "The configuration is invalid, run 'config validate' for details", nil)
+
+	masked, err := Model.GetConfig().BackupConfig.Masked()
+	Utils.HaltOnError(Utils.GetLogger(), err, "Impossible to mask the configuration secrets")
+	content, err := yaml.Marshal(masked)
+	Utils.HaltOnError(Utils.GetLogger(), err, "Impossible to display configuration")
+	fmt.Print("---\n" + string(content))
+}
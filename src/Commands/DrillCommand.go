@@ -0,0 +1,80 @@
+package Commands
+
+import (
+	"errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gobackup/src/Model"
+	"gobackup/src/Services"
+	"gobackup/src/Utils"
+	"os"
+)
+
+func DrillCommand() *cobra.Command {
+	dc := &cobra.Command{
+		Use:   "drill",
+		Short: "Restore a sample of the latest snapshot and verify it",
+		Long:  "Restore a sample of files from the latest snapshot into a temporary directory, compare them with the repository and run the verification command",
+		Args:  cobra.NoArgs,
+		Run:   RunDrill,
+	}
+
+	dc.Flags().StringP("repo", "r", "", "Restic repository name")
+	dc.Flags().StringP("job", "j", "", "Job name from the configuration")
+	dc.Flags().String("metrics-file", "drill.prom", "Export metrics file as Prometheus format")
+	dc.Flags().Bool("dry-run", false, "Show the commands without restoring anything")
+
+	return dc
+}
+
+func RunDrill(cmd *cobra.Command, args []string) {
+	var repositoryName string
+	var jobName string
+	var metricsFilename string
+	var dryRun bool
+	cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		switch flag.Name {
+		case "repo":
+			repositoryName = flag.Value.String()
+		case "job":
+			jobName = flag.Value.String()
+		case "metrics-file":
+			metricsFilename = flag.Value.String()
+		case "dry-run":
+			dryRun = flag.Value.String() == "true"
+		default:
+			break
+		}
+	})
+
+	job := Model.GetConfig().BackupConfig.RepositoryJob(repositoryName)
+	if jobName != "" {
+		var err error
+		job, err = Model.GetConfig().BackupConfig.FindJob(jobName)
+		Utils.HaltOnError(Utils.GetLogger(), err, "")
+	}
+	if job.Repository == "" {
+		Utils.HaltOnError(Utils.GetLogger(), errors.New("a repository (-r) or a job (--job) is required"), "")
+	}
+
+	Model.GetConfig().GetResticPassword()
+
+	email, err := Services.NewEmailServer(Model.GetConfig())
+	Utils.HaltOnError(Utils.GetLogger(), err, "")
+
+	startRunLog(job, dryRun)
+	Services.InitBackupManager(Model.GetConfig(), job)
+	bm := Services.GetBackupManager()
+	bm.DryRun = dryRun
+	bm.ReportTitle = "Restore drill"
+	bm.RestoreDrill(true)
+	bm.GetResults()
+	err = _report(bm, email, metricsFilename, !dryRun)
+
+	if bm.LastResult != nil && bm.LastResult.Status == Services.Failed {
+		os.Exit(1)
+	}
+	if err != nil {
+		os.Exit(Utils.ExitNotification)
+	}
+}
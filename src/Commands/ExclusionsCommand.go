@@ -0,0 +1,116 @@
+package Commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gobackup/src/Model"
+	"gobackup/src/Services"
+	"gobackup/src/Utils"
+	"os"
+	"text/tabwriter"
+)
+
+func ExclusionsCommand() *cobra.Command {
+	ec := &cobra.Command{
+		Use:   "exclusions",
+		Short: "Exclusions helper command",
+		Long:  "Exclusions helper command, check which files the exclusions of a job leave out of the backups",
+	}
+
+	tc := &cobra.Command{
+		Use:         "test [path...]",
+		Short:       "List the files excluded from the backup",
+		Long:        "Walk the folders of the job, or the given paths, with the exclusions of the job and list the excluded files, the rule excluding them and the rules never matching",
+		Args:        cobra.ArbitraryArgs,
+		Run:         RunExclusionsTest,
+		Annotations: dataOutput,
+	}
+	tc.Flags().StringP("repo", "r", "", "Restic repository name, the exclusions of its job are used")
+	tc.Flags().StringP("job", "j", "", "Job name from the configuration")
+	tc.Flags().Bool("json", false, "Output as json")
+	ec.AddCommand(tc)
+
+	return ec
+}
+
+func RunExclusionsTest(cmd *cobra.Command, args []string) {
+	var repositoryName string
+	var jobName string
+	var jsonOutput bool
+	cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		switch flag.Name {
+		case "repo":
+			repositoryName = flag.Value.String()
+		case "job":
+			jobName = flag.Value.String()
+		case "json":
+			jsonOutput = flag.Value.String() == "true"
+		default:
+			break
+		}
+	})
+
+	config := Model.GetConfig().BackupConfig
+	job, err := _exclusionsJob(config, jobName, repositoryName)
+	Utils.HaltWithCode(Utils.GetLogger(), err, "", Utils.ExitConfig)
+	paths := args
+	if len(paths) == 0 {
+		paths = job.Folders
+	}
+	if len(paths) == 0 {
+		Utils.HaltWithCode(Utils.GetLogger(), errors.New("the job has no folders, give the paths to test"), "", Utils.ExitConfig)
+	}
+
+	report, err := Services.TestExclusions(config.JobExclusions(job), paths)
+	Utils.HaltOnError(Utils.GetLogger(), err, "Impossible to test the exclusions")
+
+	if jsonOutput {
+		content, err := json.MarshalIndent(report, "", "  ")
+		Utils.HaltOnError(Utils.GetLogger(), err, "")
+		fmt.Println(string(content))
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "EXCLUDED\tSIZE\tRULE")
+	for _, excluded := range report.Excluded {
+		path := excluded.Path
+		if excluded.Dir {
+			path += "/"
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\n", path, Utils.HumanBytes(excluded.Size), excluded.Rule)
+	}
+	_ = w.Flush()
+
+	fmt.Printf("\nExcluded: %d path(s), %s\n", len(report.Excluded), Utils.HumanBytes(report.Size))
+	if unused := report.Unused(); len(unused) > 0 {
+		fmt.Println("\nRules never matching:")
+		for _, rule := range unused {
+			fmt.Println("  " + rule)
+		}
+	}
+	if len(report.Unreached) > 0 {
+		fmt.Println("\nNegated rules inside an excluded folder, never applied:")
+		for _, unreached := range report.Unreached {
+			fmt.Printf("  %s (%s/)\n", unreached.Rule, unreached.Folder)
+		}
+	}
+	for _, err := range report.Errors {
+		_, _ = fmt.Fprintln(os.Stderr, "Error: "+err)
+	}
+}
+
+// _exclusionsJob returns the job, or the job of the repository. A repository
+// without a job only has the shared exclusions.
+func _exclusionsJob(config *Model.BackupConfig, jobName string, repositoryName string) (*Model.Job, error) {
+	if jobName != "" {
+		return config.FindJob(jobName)
+	}
+	if repositoryName == "" {
+		return nil, errors.New("a repository (-r) or a job (--job) is required")
+	}
+	return config.RepositoryJob(repositoryName), nil
+}
@@ -0,0 +1,143 @@
+package Commands
+
+import (
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gobackup/src/Model"
+	"gobackup/src/Services"
+	"gobackup/src/Utils"
+	"os"
+	"strings"
+	"time"
+)
+
+// Nagios plugin exit codes
+const (
+	nagiosOk       = 0
+	nagiosWarning  = 1
+	nagiosCritical = 2
+	nagiosUnknown  = 3
+)
+
+var nagiosStates = []string{"OK", "WARNING", "CRITICAL", "UNKNOWN"}
+
+// nagiosRanks orders the states by importance, a stale repository is more
+// important than one which can't be checked
+var nagiosRanks = map[int]int{nagiosOk: 0, nagiosUnknown: 1, nagiosWarning: 2, nagiosCritical: 3}
+
+func FreshnessCommand() *cobra.Command {
+	fc := &cobra.Command{
+		Use:   "check-freshness",
+		Short: "Nagios plugin checking the age of the latest snapshots",
+		Long:  "Nagios/Icinga plugin checking the age of the latest snapshot of every repository of the configured jobs, with the age, size and file count as perfdata",
+		Args:  cobra.NoArgs,
+		// Configuration errors must be reported as UNKNOWN, not halt
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+		Run:              RunFreshness,
+	}
+
+	fc.Flags().StringP("repo", "r", "", "Only check this repository")
+	fc.Flags().String("warning", "26h", "Age of the latest snapshot for a warning (26h, 2d)")
+	fc.Flags().String("critical", "50h", "Age of the latest snapshot for a critical state (50h, 3d)")
+
+	return fc
+}
+
+func RunFreshness(cmd *cobra.Command, args []string) {
+	var repositoryName string
+	var warningValue, criticalValue string
+	cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		switch flag.Name {
+		case "repo":
+			repositoryName = flag.Value.String()
+		case "warning":
+			warningValue = flag.Value.String()
+		case "critical":
+			criticalValue = flag.Value.String()
+		default:
+			break
+		}
+	})
+
+	warning, err := Utils.ParseDuration(warningValue)
+	_unknownOnError(err)
+	critical, err := Utils.ParseDuration(criticalValue)
+	_unknownOnError(err)
+	if critical < warning {
+		_unknownOnError(errors.New("--critical must be greater than --warning"))
+	}
+	_unknownOnError(Model.GetConfig().LoadBackupConfig(configPaths(cmd)...))
+	if os.Getenv("RESTIC_PASSWORD") == "" {
+		_unknownOnError(errors.New("RESTIC_PASSWORD is required"))
+	}
+	Model.GetConfig().GetResticPassword()
+
+	repositories := Model.GetConfig().BackupConfig.Repositories()
+	if repositoryName != "" {
+		repositories = []string{repositoryName}
+	}
+	if len(repositories) == 0 {
+		_unknownOnError(errors.New("no job is configured, a repository (-r) is required"))
+	}
+
+	now := time.Now()
+	state := nagiosOk
+	problems := make([]string, 0)
+	details := make([]string, 0, len(repositories))
+	perfdata := make([]string, 0, len(repositories)*3)
+	for _, repository := range repositories {
+		Services.InitBackupManager(Model.GetConfig(), Model.GetConfig().BackupConfig.RepositoryJob(repository))
+		snapshot, err := Services.GetBackupManager().LatestSnapshot()
+
+		repositoryState := nagiosOk
+		var detail string
+		switch {
+		case err != nil:
+			repositoryState = nagiosUnknown
+			detail = err.Error()
+		case snapshot == nil:
+			repositoryState = nagiosCritical
+			detail = "no snapshot"
+		default:
+			age := now.Sub(snapshot.Time)
+			if age >= critical {
+				repositoryState = nagiosCritical
+			} else if age >= warning {
+				repositoryState = nagiosWarning
+			}
+			detail = fmt.Sprintf("latest snapshot %s %s ago", snapshot.ShortId, Utils.HumanDuration(age.Seconds()))
+			perfdata = append(perfdata,
+				fmt.Sprintf("'%s_age'=%ds;%d;%d;0;", repository, int(age.Seconds()), int(warning.Seconds()), int(critical.Seconds())),
+				fmt.Sprintf("'%s_size'=%dB;;;0;", repository, snapshot.Size),
+				fmt.Sprintf("'%s_files'=%d;;;0;", repository, snapshot.FileCount),
+			)
+		}
+
+		details = append(details, fmt.Sprintf("%s: %s, %s", repository, nagiosStates[repositoryState], detail))
+		if repositoryState != nagiosOk {
+			problems = append(problems, repository+": "+detail)
+		}
+		if nagiosRanks[repositoryState] > nagiosRanks[state] {
+			state = repositoryState
+		}
+	}
+
+	summary := fmt.Sprintf("%d repositories up to date", len(repositories))
+	if len(problems) > 0 {
+		summary = strings.Join(problems, ", ")
+	}
+	fmt.Printf("BACKUP %s - %s | %s\n", nagiosStates[state], summary, strings.Join(perfdata, " "))
+	fmt.Println(strings.Join(details, "\n"))
+	os.Exit(state)
+}
+
+func _unknownOnError(err error) {
+	if err == nil {
+		return
+	}
+	message := strings.ReplaceAll(err.Error(), "\n", ", ")
+	fmt.Printf("BACKUP %s - %s\n", nagiosStates[nagiosUnknown], message)
+	os.Exit(nagiosUnknown)
+}
@@ -12,11 +12,12 @@ import (
 
 func HelperCommand() *cobra.Command {
 	bc := &cobra.Command{
-		Use:   "restic",
-		Short: "Restic helper command",
-		Long:  "Restic helper command, allows you to use restic using the config file",
-		Args:  cobra.MinimumNArgs(1),
-		Run:   RunRestic,
+		Use:         "restic",
+		Short:       "Restic helper command",
+		Long:        "Restic helper command, allows you to use restic using the config file",
+		Args:        cobra.MinimumNArgs(1),
+		Run:         RunRestic,
+		Annotations: dataOutput,
 	}
 
 	bc.Flags().StringP("repo", "r", "", "Restic repository name")
@@ -36,7 +37,7 @@ func RunRestic(cmd *cobra.Command, args []string) {
 	})
 	Model.GetConfig().GetResticPassword()
 
-	Services.InitBackupManager(Model.GetConfig(), repositoryName, []string{})
+	Services.InitBackupManager(Model.GetConfig(), Model.GetConfig().BackupConfig.RepositoryJob(repositoryName))
 	bm := Services.GetBackupManager()
 	res, err := bm.ExecuteRestic(strings.Join(args, " "))
 
@@ -0,0 +1,92 @@
+package Commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gobackup/src/Model"
+	"gobackup/src/Services"
+	"gobackup/src/Utils"
+	"os"
+	"strconv"
+	"text/tabwriter"
+)
+
+func HistoryCommand() *cobra.Command {
+	hc := &cobra.Command{
+		Use:         "history",
+		Short:       "Show the previous runs",
+		Long:        "Show the previous runs from the history of the state directory, with the size of the repositories over time",
+		Args:        cobra.NoArgs,
+		Run:         RunHistory,
+		Annotations: dataOutput,
+	}
+
+	hc.Flags().StringP("repo", "r", "", "Only show the runs of this repository")
+	hc.Flags().Int("limit", 20, "Number of runs to show, 0 for all")
+	hc.Flags().Bool("json", false, "Output as json")
+
+	return hc
+}
+
+func RunHistory(cmd *cobra.Command, args []string) {
+	var repositoryName string
+	var limit int
+	var jsonOutput bool
+	cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		switch flag.Name {
+		case "repo":
+			repositoryName = flag.Value.String()
+		case "limit":
+			limit, _ = strconv.Atoi(flag.Value.String())
+		case "json":
+			jsonOutput = flag.Value.String() == "true"
+		default:
+			break
+		}
+	})
+
+	history, err := Services.ReadHistory(Model.GetConfig().BackupConfig.StateDir)
+	Utils.HaltOnError(Utils.GetLogger(), err, "Impossible to read the history")
+
+	entries := make([]Services.HistoryEntry, 0, len(history))
+	for _, entry := range history {
+		if repositoryName == "" || entry.Repository == repositoryName {
+			entries = append(entries, entry)
+		}
+	}
+	if limit > 0 && len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+
+	if jsonOutput {
+		content, err := json.MarshalIndent(entries, "", "  ")
+		Utils.HaltOnError(Utils.GetLogger(), err, "")
+		fmt.Println(string(content))
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "TIME\tREPOSITORY\tJOB\tSTATUS\tDURATION\tADDED\tSTORED\tRESTORE SIZE\tDEDUP")
+	for _, entry := range entries {
+		stored, restore, dedup := "-", "-", "-"
+		if entry.Size != nil {
+			stored = Utils.HumanBytes(entry.Size.StoredBytes)
+			restore = Utils.HumanBytes(entry.Size.RestoreBytes)
+			dedup = fmt.Sprintf("%.2fx", entry.Size.DedupRatio)
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			entry.Time.Local().Format("2006-01-02 15:04:05"),
+			entry.Repository,
+			entry.Job,
+			entry.Status,
+			Utils.HumanDuration(entry.Duration),
+			Utils.HumanBytes(entry.Stats.BytesAdded),
+			stored,
+			restore,
+			dedup,
+		)
+	}
+	_ = w.Flush()
+}
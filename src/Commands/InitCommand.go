@@ -0,0 +1,92 @@
+package Commands
+
+import (
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gobackup/src/Model"
+	"gobackup/src/Services"
+	"gobackup/src/Utils"
+	"os"
+)
+
+func InitCommand() *cobra.Command {
+	ic := &cobra.Command{
+		Use:   "init",
+		Short: "Initialize a restic repository",
+		Long:  "Initialize a restic repository, by name or from a job of the configuration",
+		Args:  cobra.NoArgs,
+		Run:   RunInit,
+	}
+
+	ic.Flags().StringP("repo", "r", "", "Restic repository name")
+	ic.Flags().StringP("job", "j", "", "Job name from the configuration")
+	ic.Flags().String("from-repo", "", "Repository name to copy the chunker parameters from (RESTIC_FROM_PASSWORD if the password differs)")
+	ic.Flags().Bool("copy-chunker-params", false, "Copy the chunker parameters from --from-repo, to deduplicate between repositories")
+	ic.Flags().String("copy-target", "", "Initialize the secondary repository of the job (--job) with this name, sharing the chunker parameters")
+	ic.Flags().String("repository-version", "", "Repository format version (1, 2 or latest), overrides repository.version")
+
+	return ic
+}
+
+func RunInit(cmd *cobra.Command, args []string) {
+	var repositoryName string
+	var jobName string
+	var copyTarget string
+	var initOptions Services.InitOptions
+	cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		switch flag.Name {
+		case "repo":
+			repositoryName = flag.Value.String()
+		case "job":
+			jobName = flag.Value.String()
+		case "from-repo":
+			initOptions.FromRepository = flag.Value.String()
+		case "copy-chunker-params":
+			initOptions.CopyChunkerParams = flag.Value.String() == "true"
+		case "copy-target":
+			copyTarget = flag.Value.String()
+		case "repository-version":
+			initOptions.RepositoryVersion = flag.Value.String()
+		default:
+			break
+		}
+	})
+
+	job := Model.GetConfig().BackupConfig.RepositoryJob(repositoryName)
+	if jobName != "" {
+		var err error
+		job, err = Model.GetConfig().BackupConfig.FindJob(jobName)
+		Utils.HaltOnError(Utils.GetLogger(), err, "")
+	}
+	if job.Repository == "" {
+		Utils.HaltOnError(Utils.GetLogger(), errors.New("a repository (-r) or a job (--job) is required"), "")
+	}
+	if copyTarget != "" {
+		if jobName == "" {
+			Utils.HaltOnError(Utils.GetLogger(), errors.New("--copy-target requires --job"), "")
+		}
+		var err error
+		initOptions.CopyTarget, err = job.FindCopyTarget(copyTarget)
+		Utils.HaltOnError(Utils.GetLogger(), err, "")
+	} else if initOptions.CopyChunkerParams && initOptions.FromRepository == "" {
+		Utils.HaltOnError(Utils.GetLogger(), errors.New("--copy-chunker-params requires --from-repo"), "")
+	}
+
+	Model.GetConfig().GetResticPassword()
+
+	Services.InitBackupManager(Model.GetConfig(), job)
+	bm := Services.GetBackupManager()
+	bm.InitRepo(initOptions)
+
+	if bm.LastResult.Status != Services.Success {
+		_, _ = fmt.Fprintln(os.Stderr, bm.LastResult.Output)
+		os.Exit(1)
+	}
+	if copyTarget != "" {
+		fmt.Printf("Repository '%s' of job '%s' initialized\n", copyTarget, job.Name)
+		return
+	}
+	fmt.Printf("Repository '%s' initialized\n", job.Repository)
+}
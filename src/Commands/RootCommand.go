@@ -3,6 +3,7 @@ package Commands
 import (
 	"github.com/spf13/cobra"
 	"gobackup/src/Model"
+	"gobackup/src/Utils"
 	"os"
 )
 
@@ -12,11 +13,46 @@ func RootCommand() *cobra.Command {
 		PersistentPreRun: Root,
 	}
 	rc.PersistentFlags().StringP("config", "c", "config.yml", "Configuration file in yaml format")
+	rc.PersistentFlags().String("config-dir", "", "Directory of yaml configuration fragments, merged in lexical order")
 
 	return rc
 }
 
+// dataOutput marks the commands printing data on stdout, their logs are never
+// written on stdout to keep the json or csv output readable by scripts.
+var dataOutput = map[string]string{"data_output": "true"}
+
 func Root(cmd *cobra.Command, args []string) {
+	Model.GetConfig().InitBackupConfig(configPaths(cmd)...)
+	options := Model.GetConfig().LoggingOptions()
+	if cmd.Annotations["data_output"] == "true" && options.Destination == "stdout" {
+		options.Destination = "stderr"
+	}
+	err := Utils.ConfigureLogger(options)
+	Utils.HaltOnError(Utils.GetLogger(), err, "Impossible to configure the logs")
+}
+
+// startRunLog copies the logs of the run of this job to the run directory,
+// nothing is written in dry-run.
+func startRunLog(job *Model.Job, dryRun bool) {
+	logging := Model.GetConfig().BackupConfig.Logging
+	Utils.SetLogField("job", job.Name)
+	if logging.RunDir == "" || dryRun {
+		return
+	}
+	path, err := Utils.StartRunLog(logging.RunDir, job.Name, logging.MaxAge)
+	Utils.WarnOnError(Utils.GetLogger(), err, "Impossible to create the log file of the run", nil)
+	Utils.GetLogger().Debug("Logs of the run in ", path)
+}
+
+func configPaths(cmd *cobra.Command) []string {
 	filename, _ := cmd.Flags().GetString("config")
-	Model.GetConfig().InitBackupConfig(filename)
+	dir, _ := cmd.Flags().GetString("config-dir")
+	if dir == "" {
+		return []string{filename}
+	}
+	if cmd.Flags().Changed("config") {
+		return []string{filename, dir}
+	}
+	return []string{dir}
 }
@@ -0,0 +1,191 @@
+package Commands
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gobackup/src/Model"
+	"gobackup/src/Services"
+	"gobackup/src/Utils"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+type snapshotRow struct {
+	Repository string    `json:"repository"`
+	Id         string    `json:"id"`
+	ShortId    string    `json:"short_id"`
+	Time       time.Time `json:"time"`
+	AgeSeconds int       `json:"age_seconds"`
+	Hostname   string    `json:"hostname"`
+	Tags       []string  `json:"tags"`
+	Paths      []string  `json:"paths"`
+	Size       int       `json:"size"`
+}
+
+func SnapshotsCommand() *cobra.Command {
+	sc := &cobra.Command{
+		Use:         "snapshots",
+		Short:       "List the snapshots of the repositories",
+		Long:        "List the snapshots of a repository, or of every repository of the configured jobs, with their age, tags, paths and size",
+		Args:        cobra.NoArgs,
+		Run:         RunSnapshots,
+		Annotations: dataOutput,
+	}
+
+	sc.Flags().StringP("repo", "r", "", "Restic repository name")
+	sc.Flags().Bool("all-repos", false, "List the snapshots of every repository of the configured jobs")
+	sc.Flags().Bool("json", false, "Output as json")
+	sc.Flags().Bool("table", false, "Output as a table (default)")
+	sc.Flags().Bool("csv", false, "Output as csv")
+	sc.Flags().StringArray("tag", nil, "Only snapshots with this tag, several tags separated by a comma must all match (can be repeated)")
+	sc.Flags().StringArray("path", nil, "Only snapshots of this path (can be repeated)")
+	sc.Flags().String("since", "", "Only snapshots taken after this date (2006-01-02, 2006-01-02 15:04 or a duration like 7d)")
+	sc.Flags().String("until", "", "Only snapshots taken before this date (2006-01-02, 2006-01-02 15:04 or a duration like 7d)")
+
+	return sc
+}
+
+func RunSnapshots(cmd *cobra.Command, args []string) {
+	var repositoryName string
+	var allRepos bool
+	var formats []string
+	var since, until string
+	var filter Services.SnapshotFilter
+	cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		switch flag.Name {
+		case "repo":
+			repositoryName = flag.Value.String()
+		case "all-repos":
+			allRepos = flag.Value.String() == "true"
+		case "json", "table", "csv":
+			if flag.Value.String() == "true" {
+				formats = append(formats, flag.Name)
+			}
+		case "tag":
+			filter.Tags = flag.Value.(pflag.SliceValue).GetSlice()
+		case "path":
+			filter.Paths = flag.Value.(pflag.SliceValue).GetSlice()
+		case "since":
+			since = flag.Value.String()
+		case "until":
+			until = flag.Value.String()
+		default:
+			break
+		}
+	})
+
+	if len(formats) > 1 {
+		Utils.HaltOnError(Utils.GetLogger(), errors.New("only one of --json, --table and --csv can be given"), "")
+	}
+	format := "table"
+	if len(formats) == 1 {
+		format = formats[0]
+	}
+	now := time.Now()
+	var err error
+	if since != "" {
+		filter.Since, err = Utils.ParseTime(since, now, false)
+		Utils.HaltOnError(Utils.GetLogger(), err, "")
+	}
+	if until != "" {
+		filter.Until, err = Utils.ParseTime(until, now, true)
+		Utils.HaltOnError(Utils.GetLogger(), err, "")
+	}
+
+	repositories := []string{repositoryName}
+	if allRepos {
+		if repositoryName != "" {
+			Utils.HaltOnError(Utils.GetLogger(), errors.New("a repository (-r) can't be given with --all-repos"), "")
+		}
+		repositories = Model.GetConfig().BackupConfig.Repositories()
+		if len(repositories) == 0 {
+			Utils.HaltOnError(Utils.GetLogger(), errors.New("no job is configured"), "")
+		}
+	} else if repositoryName == "" {
+		Utils.HaltOnError(Utils.GetLogger(), errors.New("a repository (-r) or --all-repos is required"), "")
+	}
+
+	Model.GetConfig().GetResticPassword()
+
+	rows := make([]snapshotRow, 0)
+	failed := false
+	for _, repository := range repositories {
+		Services.InitBackupManager(Model.GetConfig(), Model.GetConfig().BackupConfig.RepositoryJob(repository))
+		snapshots, err := Services.GetBackupManager().Snapshots(filter)
+		if err != nil {
+			Utils.GetLogger().Error("Repository ", repository, ": ", err)
+			failed = true
+			continue
+		}
+		for _, snapshot := range snapshots {
+			rows = append(rows, snapshotRow{
+				Repository: repository,
+				Id:         snapshot.Id,
+				ShortId:    snapshot.ShortId,
+				Time:       snapshot.Time,
+				AgeSeconds: int(now.Sub(snapshot.Time).Seconds()),
+				Hostname:   snapshot.Hostname,
+				Tags:       snapshot.Tags,
+				Paths:      snapshot.Paths,
+				Size:       snapshot.Size,
+			})
+		}
+	}
+
+	switch format {
+	case "json":
+		content, err := json.MarshalIndent(rows, "", "  ")
+		Utils.HaltOnError(Utils.GetLogger(), err, "")
+		fmt.Println(string(content))
+	case "csv":
+		_printSnapshotsCsv(rows)
+	default:
+		_printSnapshotsTable(rows)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func _printSnapshotsTable(rows []snapshotRow) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "REPOSITORY\tID\tTIME\tAGE\tHOST\tTAGS\tPATHS\tSIZE")
+	for _, row := range rows {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			row.Repository,
+			row.ShortId,
+			row.Time.Local().Format("2006-01-02 15:04:05"),
+			Utils.HumanDuration(float64(row.AgeSeconds)),
+			row.Hostname,
+			strings.Join(row.Tags, ","),
+			strings.Join(row.Paths, ","),
+			Utils.HumanBytes(row.Size),
+		)
+	}
+	_ = w.Flush()
+}
+
+func _printSnapshotsCsv(rows []snapshotRow) {
+	w := csv.NewWriter(os.Stdout)
+	_ = w.Write([]string{"repository", "id", "time", "age_seconds", "hostname", "tags", "paths", "size"})
+	for _, row := range rows {
+		_ = w.Write([]string{
+			row.Repository,
+			row.Id,
+			row.Time.Format(time.RFC3339),
+			strconv.Itoa(row.AgeSeconds),
+			row.Hostname,
+			strings.Join(row.Tags, ","),
+			strings.Join(row.Paths, ","),
+			strconv.Itoa(row.Size),
+		})
+	}
+	w.Flush()
+}
@@ -0,0 +1,153 @@
+package Commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gobackup/src/Model"
+	"gobackup/src/Services"
+	"gobackup/src/Utils"
+	"golang.org/x/term"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	colorReset  = "\033[0m"
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+)
+
+func StatusCommand() *cobra.Command {
+	sc := &cobra.Command{
+		Use:   "status",
+		Short: "Show the backup health of the repositories",
+		Long: "Show the latest snapshot, last run, size, locks and retention policy of every repository of the configured jobs.\n" +
+			"Exit code: 0 when every repository is up to date, 1 when a repository is stale, 2 when a repository can't be read",
+		Args:        cobra.NoArgs,
+		Run:         RunStatus,
+		Annotations: dataOutput,
+	}
+
+	sc.Flags().StringP("repo", "r", "", "Only show this repository")
+	sc.Flags().String("max-age", "26h", "Age of the latest snapshot after which a repository is stale (26h, 2d)")
+	sc.Flags().Bool("json", false, "Output as json")
+	sc.Flags().Bool("no-color", false, "Disable the colors, they are only used in a terminal")
+
+	return sc
+}
+
+func RunStatus(cmd *cobra.Command, args []string) {
+	var repositoryName string
+	var maxAgeValue string
+	var jsonOutput, noColor bool
+	cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		switch flag.Name {
+		case "repo":
+			repositoryName = flag.Value.String()
+		case "max-age":
+			maxAgeValue = flag.Value.String()
+		case "json":
+			jsonOutput = flag.Value.String() == "true"
+		case "no-color":
+			noColor = flag.Value.String() == "true"
+		default:
+			break
+		}
+	})
+
+	maxAge, err := Utils.ParseDuration(maxAgeValue)
+	Utils.HaltOnError(Utils.GetLogger(), err, "")
+	repositories := Model.GetConfig().BackupConfig.Repositories()
+	if repositoryName != "" {
+		repositories = []string{repositoryName}
+	}
+	if len(repositories) == 0 {
+		Utils.HaltOnError(Utils.GetLogger(), errors.New("no job is configured, a repository (-r) is required"), "")
+	}
+
+	Model.GetConfig().GetResticPassword()
+
+	history, err := Services.ReadHistory(Model.GetConfig().BackupConfig.StateDir)
+	Utils.WarnOnError(Utils.GetLogger(), err, "Impossible to read the history", nil)
+
+	now := time.Now()
+	statuses := make([]Services.RepositoryStatus, 0, len(repositories))
+	exitCode := 0
+	for _, repository := range repositories {
+		Services.InitBackupManager(Model.GetConfig(), Model.GetConfig().BackupConfig.RepositoryJob(repository))
+		status := Services.GetBackupManager().Status(history, maxAge, now)
+		statuses = append(statuses, status)
+		if status.Health == Services.HealthError {
+			exitCode = 2
+		} else if status.Health == Services.HealthStale && exitCode == 0 {
+			exitCode = 1
+		}
+	}
+
+	if jsonOutput {
+		content, err := json.MarshalIndent(statuses, "", "  ")
+		Utils.HaltOnError(Utils.GetLogger(), err, "")
+		fmt.Println(string(content))
+	} else {
+		colored := !noColor && term.IsTerminal(int(os.Stdout.Fd()))
+		for _, status := range statuses {
+			_printStatus(status, now, colored)
+		}
+	}
+	os.Exit(exitCode)
+}
+
+func _printStatus(status Services.RepositoryStatus, now time.Time, colored bool) {
+	health := strings.ToUpper(status.Health)
+	if colored {
+		color := colorGreen
+		switch status.Health {
+		case Services.HealthWarning:
+			color = colorYellow
+		case Services.HealthStale, Services.HealthError:
+			color = colorRed
+		}
+		health = color + health + colorReset
+	}
+	fmt.Printf("%s [%s]\n", status.Repository, health)
+
+	latest := "none"
+	if status.LatestSnapshot != nil {
+		latest = fmt.Sprintf("%s, %s (%s ago)",
+			status.LatestSnapshot.ShortId,
+			status.LatestSnapshot.Time.Local().Format("2006-01-02 15:04:05"),
+			Utils.HumanDuration(float64(status.AgeSeconds)),
+		)
+	}
+	lastRun := "unknown"
+	if status.LastRun != nil {
+		lastRun = fmt.Sprintf("%s, %s (%s ago, took %s)",
+			status.LastRun.Status,
+			status.LastRun.Time.Local().Format("2006-01-02 15:04:05"),
+			Utils.HumanDuration(now.Sub(status.LastRun.Time).Seconds()),
+			Utils.HumanDuration(status.LastRun.Duration),
+		)
+	}
+	lock := "unlocked"
+	if status.Locks > 0 {
+		lock = fmt.Sprintf("locked (%d lock(s))", status.Locks)
+	}
+	retention := strings.Join(status.Retention, " ")
+	if retention == "" {
+		retention = "none"
+	}
+
+	fmt.Printf("  %-17s%s\n", "Latest snapshot", latest)
+	fmt.Printf("  %-17s%s\n", "Last run", lastRun)
+	fmt.Printf("  %-17s%s\n", "Size", Utils.HumanBytes(status.Size))
+	fmt.Printf("  %-17s%s\n", "Lock", lock)
+	fmt.Printf("  %-17s%s\n", "Retention", retention)
+	for _, err := range status.Errors {
+		fmt.Printf("  %-17s%s\n", "Error", err)
+	}
+}
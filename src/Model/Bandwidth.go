@@ -0,0 +1,102 @@
+package Model
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var rateReg = regexp.MustCompile(`^(\d+)([KMG]?)$`)
+
+// Bandwidth limits restic, and rclone, in KiB/s like restic when no unit is
+// given. The first window containing the current time overrides the limits.
+type Bandwidth struct {
+	LimitUpload   string            `yaml:"limit_upload" validate:"rate"`
+	LimitDownload string            `yaml:"limit_download" validate:"rate"`
+	Windows       []BandwidthWindow `yaml:"windows"`
+}
+
+// BandwidthWindow applies its limits from From to To (HH:MM), it can span
+// midnight. An empty limit keeps the default one.
+type BandwidthWindow struct {
+	From          string `yaml:"from" required:"true"`
+	To            string `yaml:"to" required:"true"`
+	LimitUpload   string `yaml:"limit_upload" validate:"rate"`
+	LimitDownload string `yaml:"limit_download" validate:"rate"`
+}
+
+func (w BandwidthWindow) validate() ValidationErrors {
+	errs := make(ValidationErrors, 0)
+	if _, err := parseClock(w.From); w.From != "" && err != nil {
+		errs = append(errs, ValidationError{Field: "from", Message: err.Error()})
+	}
+	if _, err := parseClock(w.To); w.To != "" && err != nil {
+		errs = append(errs, ValidationError{Field: "to", Message: err.Error()})
+	}
+	return errs
+}
+
+func (w BandwidthWindow) contains(now time.Time) bool {
+	from, errFrom := parseClock(w.From)
+	to, errTo := parseClock(w.To)
+	if errFrom != nil || errTo != nil {
+		return false
+	}
+	minutes := now.Hour()*60 + now.Minute()
+	if from <= to {
+		return minutes >= from && minutes < to
+	}
+	return minutes >= from || minutes < to
+}
+
+// Limits returns the upload and download limits in KiB/s at this time, 0 when unlimited.
+func (b *Bandwidth) Limits(now time.Time) (int, int) {
+	if b == nil {
+		return 0, 0
+	}
+	upload, download := b.LimitUpload, b.LimitDownload
+	for _, window := range b.Windows {
+		if !window.contains(now) {
+			continue
+		}
+		if window.LimitUpload != "" {
+			upload = window.LimitUpload
+		}
+		if window.LimitDownload != "" {
+			download = window.LimitDownload
+		}
+		break
+	}
+	return rateToKiB(upload), rateToKiB(download)
+}
+
+func rateToKiB(rate string) int {
+	match := rateReg.FindStringSubmatch(rate)
+	if len(match) != 3 {
+		return 0
+	}
+	value, _ := strconv.Atoi(match[1])
+	switch match[2] {
+	case "M":
+		return value * 1024
+	case "G":
+		return value * 1024 * 1024
+	}
+	return value
+}
+
+// parseClock returns the number of minutes since midnight.
+func parseClock(value string) (int, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("'%s' must be a time of day (22:00)", value)
+	}
+	hours, errHours := strconv.Atoi(parts[0])
+	minutes, errMinutes := strconv.Atoi(parts[1])
+	if errHours != nil || errMinutes != nil || hours < 0 || hours > 23 || minutes < 0 || minutes > 59 {
+		return 0, fmt.Errorf("'%s' must be a time of day (22:00)", value)
+	}
+	return hours*60 + minutes, nil
+}
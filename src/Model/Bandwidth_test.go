@@ -0,0 +1,64 @@
+package Model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBandwidthLimits(t *testing.T) {
+	bandwidth := &Bandwidth{
+		LimitUpload:   "2M",
+		LimitDownload: "4096",
+		Windows: []BandwidthWindow{
+			// Unlimited upload during the night
+			{From: "22:00", To: "06:00", LimitUpload: "0"},
+			{From: "17:00", To: "18:00", LimitDownload: "512"},
+			// Never applied, the night window comes first
+			{From: "23:00", To: "23:30", LimitUpload: "1G"},
+		},
+	}
+	for _, test := range []struct {
+		clock    string
+		upload   int
+		download int
+	}{
+		{"12:00", 2048, 4096},
+		{"21:59", 2048, 4096},
+		{"22:00", 0, 4096},
+		{"23:15", 0, 4096},
+		{"00:00", 0, 4096},
+		{"05:59", 0, 4096},
+		{"06:00", 2048, 4096},
+		{"17:00", 2048, 512},
+		{"17:59", 2048, 512},
+		{"18:00", 2048, 4096},
+	} {
+		now, err := time.Parse("2006-01-02 15:04", "2024-05-02 "+test.clock)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if upload, download := bandwidth.Limits(now); upload != test.upload || download != test.download {
+			t.Errorf("%s: limits %d/%d, expected %d/%d", test.clock, upload, download, test.upload, test.download)
+		}
+	}
+
+	var unlimited *Bandwidth
+	if upload, download := unlimited.Limits(time.Now()); upload != 0 || download != 0 {
+		t.Errorf("limits %d/%d without bandwidth", upload, download)
+	}
+}
+
+func TestBandwidthWindowValidation(t *testing.T) {
+	for _, test := range []struct {
+		window BandwidthWindow
+		errors int
+	}{
+		{BandwidthWindow{From: "22:00", To: "06:00"}, 0},
+		{BandwidthWindow{From: "24:00", To: "06:00"}, 1},
+		{BandwidthWindow{From: "10pm", To: "6:60"}, 2},
+	} {
+		if errs := test.window.validate(); len(errs) != test.errors {
+			t.Errorf("%+v: errors %v, expected %d", test.window, errs, test.errors)
+		}
+	}
+}
@@ -1,16 +1,19 @@
 package Model
 
 import (
+	"bytes"
 	"fmt"
 	"gobackup/src/Utils"
 	"golang.org/x/term"
 	"gopkg.in/yaml.v2"
-	"io/ioutil"
 	"os"
+	"path/filepath"
 	"reflect"
+	"regexp"
 	"strings"
 	"sync"
 	"syscall"
+	"time"
 )
 
 type Config struct {
@@ -21,33 +24,106 @@ type Config struct {
 	ResticPassword  string
 	FoldersToBackup []string
 	Repository      string
+	// Offline skips the checks running the binaries, to lint a configuration
+	// on a host without restic
+	Offline bool
 }
 
 type BackupConfig struct {
+	Include     StringList `yaml:"include,omitempty"`
 	Information struct {
 		ClientName           string `yaml:"client_name"`
 		ServerName           string `yaml:"server_name" required:"true"`
 		RCloneConnectionName string `yaml:"rclone_connection_name" required:"true"`
 		BucketName           string `yaml:"bucket_name" required:"true"`
-		ExclusionFile        string `yaml:"exclusion_file"`
+		ExclusionFile        string `yaml:"exclusion_file" validate:"file"`
 	} `yaml:"information"`
+	Repository struct {
+		AutoInit    bool   `yaml:"auto_init"`
+		Version     string `yaml:"version" validate:"oneof=1|2|latest"`
+		Compression string `yaml:"compression" validate:"oneof=auto|off|max"`
+	} `yaml:"repository"`
 	Binaries struct {
+		// Restic is on the host of the executor, it is only checked for the local executor
 		Restic string `yaml:"restic"  required:"true"`
 	} `yaml:"binaries"`
 	Email struct {
 		Enabled  bool   `yaml:"enabled"`
-		Sender   string `yaml:"sender"`
-		Password string `yaml:"password"`
-		To       string `yaml:"to"`
-		Host     string `yaml:"host"`
-		Port     int    `yaml:"port"`
-		MaxTry   int    `yaml:"max_try"`
+		Sender   string `yaml:"sender" required_if:"enabled"`
+		Password string `yaml:"password" secret:"true"`
+		To       string `yaml:"to" required_if:"enabled"`
+		Host     string `yaml:"host" required_if:"enabled"`
+		Port     int    `yaml:"port" required_if:"enabled" validate:"port"`
+		MaxTry   int    `yaml:"max_try" validate:"positive"`
 	} `yaml:"email"`
 	Backup struct {
 		PreExecution  string `yaml:"pre_exec"`
 		PostExecution string `yaml:"post_exec"`
 	} `yaml:"backup"`
-	ResticOptions []string `yaml:"restic_opts"`
+	Forget struct {
+		Cadence string `yaml:"cadence" validate:"oneof=always|daily|weekly|never"`
+	} `yaml:"forget"`
+	Prune struct {
+		Cadence             string `yaml:"cadence" validate:"oneof=always|daily|weekly|never"`
+		MaxUnused           string `yaml:"max_unused" validate:"max_unused"`
+		MaxRepackSize       string `yaml:"max_repack_size" validate:"size"`
+		RepackCacheableOnly bool   `yaml:"repack_cacheable_only"`
+	} `yaml:"prune"`
+	Check struct {
+		Cadence        string `yaml:"cadence" validate:"oneof=always|daily|weekly|never"`
+		ReadDataSubset string `yaml:"read_data_subset"`
+		ReadDataSlices int    `yaml:"read_data_slices"`
+	} `yaml:"check"`
+	Drill struct {
+		Cadence       string        `yaml:"cadence" validate:"oneof=always|daily|weekly|never"`
+		SampleSize    int           `yaml:"sample_size"`
+		Paths         []string      `yaml:"paths"`
+		VerifyCommand string        `yaml:"verify_command"`
+		Timeout       time.Duration `yaml:"timeout"`
+		TargetDir     string        `yaml:"target_dir"`
+	} `yaml:"drill"`
+	Stats struct {
+		Cadence string `yaml:"cadence" validate:"oneof=always|daily|weekly|never"`
+	} `yaml:"stats"`
+	Diff struct {
+		Disabled bool `yaml:"disabled"`
+		Top      int  `yaml:"top"`
+	} `yaml:"diff"`
+	Logging       Logging    `yaml:"logging"`
+	Output        Output     `yaml:"output"`
+	Bandwidth     Bandwidth  `yaml:"bandwidth"`
+	Resources     Resources  `yaml:"resources"`
+	Executor      Executor   `yaml:"executor"`
+	Retention     Retention  `yaml:"retention"`
+	Exclusions    Exclusions `yaml:"exclusions"`
+	Hooks         Hooks      `yaml:"hooks"`
+	Jobs          []Job      `yaml:"jobs"`
+	ResticOptions []string   `yaml:"restic_opts"`
+	StateDir      string     `yaml:"state_dir"`
+}
+
+const (
+	AlwaysCadence = "always"
+	DailyCadence  = "daily"
+	WeeklyCadence = "weekly"
+	NeverCadence  = "never"
+)
+
+var readDataSubsetReg = regexp.MustCompile(`^(\d+(\.\d+)?%|\d+/\d+|\d+[KMGT]?)$`)
+
+type Hooks struct {
+	PreBackup  []Hook `yaml:"pre_backup"`
+	PostBackup []Hook `yaml:"post_backup"`
+	OnSuccess  []Hook `yaml:"on_success"`
+	OnFailure  []Hook `yaml:"on_failure"`
+	Always     []Hook `yaml:"always"`
+}
+
+type Hook struct {
+	Name         string        `yaml:"name"`
+	Command      string        `yaml:"command" required:"true"`
+	AbortOnError bool          `yaml:"abort_on_error"`
+	Timeout      time.Duration `yaml:"timeout"`
 }
 
 var instance *Config
@@ -61,7 +137,7 @@ func GetConfig() *Config {
 		cfg, err := getConfigEnv()
 		if err != nil {
 			fmt.Println("Error loading configuration: ", err)
-			os.Exit(1)
+			os.Exit(Utils.ExitConfig)
 		}
 		instance = cfg
 	})
@@ -94,16 +170,60 @@ func getConfigEnv() (*Config, error) {
 	return cfg, nil
 }
 
-func (c *Config) InitBackupConfig(filename string) {
-	Utils.GetLogger().Debug("Loading configuration '", filename, "'")
+func (c *Config) InitBackupConfig(paths ...string) {
+	err := c.LoadBackupConfig(paths...)
+	if errs, ok := err.(ValidationErrors); ok {
+		Utils.GetLogger().Error("The configuration '", strings.Join(paths, "', '"), "' is invalid !")
+		for _, e := range errs {
+			Utils.GetLogger().Warning("- ", e.Error())
+		}
+		os.Exit(Utils.ExitConfig)
+	}
+	Utils.HaltWithCode(Utils.GetLogger(), err, "Impossible to load configuration '"+strings.Join(paths, "', '")+"'", Utils.ExitConfig)
+}
+
+// LoadBackupConfig reads, merges, decodes and validates the configuration.
+// Each path is either a file, with its includes, or a directory whose yaml
+// fragments are merged in lexical order. The returned error is a
+// ValidationErrors listing every problem found.
+func (c *Config) LoadBackupConfig(paths ...string) error {
+	Utils.GetLogger().Debug("Loading configuration '", strings.Join(paths, "', '"), "'")
 
-	backupConfig := &c.BackupConfig
-	yamlFile, err := ioutil.ReadFile(filename)
-	Utils.HaltOnError(Utils.GetLogger(), err, "Impossible to open file '"+filename+"'")
-	err = yaml.UnmarshalStrict(yamlFile, backupConfig)
-	Utils.HaltOnError(Utils.GetLogger(), err, "Error parsing yaml")
+	errs := make(ValidationErrors, 0)
+	fragments := make([]configFragment, 0)
+	for _, path := range paths {
+		pathFragments, pathErrs := readConfigFragments(path, make(map[string]bool))
+		fragments = append(fragments, pathFragments...)
+		errs = append(errs, pathErrs...)
+	}
+	if len(fragments) == 0 && len(errs) == 0 {
+		errs = append(errs, ValidationError{File: strings.Join(paths, ", "), Message: "no configuration file found"})
+	}
+	if len(errs) > 0 {
+		return errs
+	}
 
-	c.validateBackupConfiguration()
+	// The merged configuration is decoded strictly, its errors get the file
+	// and line of their key in the fragments
+	var document yaml.MapSlice
+	origins := make(map[string]keyOrigin)
+	for _, fragment := range fragments {
+		moved := make(map[string]string)
+		document = mergeDocuments(document, fragment.Document, moved)
+		addOrigins(origins, fragment, moved)
+	}
+	merged, err := yaml.Marshal(document)
+	if err != nil {
+		return append(errs, ValidationError{Message: err.Error()})
+	}
+	c.BackupConfig = &BackupConfig{}
+	errs = append(errs, decodeBackupConfig(merged, c.BackupConfig).atKeys(keyLines(merged)).withOrigins(origins)...)
+	c.BackupConfig.setDefaults()
+	errs = append(errs, c.ValidateBackupConfig().withOrigins(origins)...)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
 }
 
 func (c *Config) GetResticPassword() {
@@ -112,7 +232,7 @@ func (c *Config) GetResticPassword() {
 		password, err := term.ReadPassword(syscall.Stdin)
 		if err != nil {
 			fmt.Println("Error: Impossible to get Restic Password")
-			os.Exit(1)
+			os.Exit(Utils.ExitPreflight)
 		}
 		c.ResticPassword = string(password)
 	} else {
@@ -120,57 +240,154 @@ func (c *Config) GetResticPassword() {
 	}
 }
 
-func (c *Config) validateBackupConfiguration() {
+func (c *Config) ValidateBackupConfig() ValidationErrors {
 	Utils.GetLogger().Debug("Checking configuration")
-	requiredFields := make(map[string]string)
-	configIsValid := _checkRequiredFields(c.BackupConfig, func(field string, yamlField string) {
-		requiredFields[field] = yamlField
-	})
+	errs := validateStruct(reflect.ValueOf(c.BackupConfig), "")
+	errs = append(errs, c.BackupConfig.validateJobs()...)
+	errs = append(errs, c.BackupConfig.validateCheck()...)
+	errs = append(errs, c.BackupConfig.validateDrill()...)
+	if file := c.BackupConfig.Information.ExclusionFile; file != "" {
+		if _, err := os.Stat(file); err == nil {
+			errs = append(errs, validatePatternFile("information.exclusion_file", file)...)
+		}
+	}
 
-	if !configIsValid {
-		Utils.GetLogger().Error("Some fields are required in the configuration !")
-		for k := range requiredFields {
-			Utils.GetLogger().Warning("- ", k, " (", requiredFields[k], ")")
+	if restic := c.BackupConfig.Binaries.Restic; restic != "" && c.BackupConfig.Executor.IsLocal() && !c.Offline {
+		if _, err := os.Stat(restic); err != nil {
+			errs = append(errs, ValidationError{Field: "binaries.restic", Message: fmt.Sprintf("file '%s' does not exist", restic)})
+		} else {
+			// The version is not printed, commands with a json output would be broken
+			var stdout bytes.Buffer
+			_, err := Utils.ExecuteCommandWithStdout(restic+" version", Utils.CommandOptions{}, &stdout)
+			Utils.GetLogger().Debug("Version: ", stdout.String())
+			if resticVersions := Utils.ResticVersionReg.FindStringSubmatch(stdout.String()); err != nil || len(resticVersions) == 0 {
+				errs = append(errs, ValidationError{Field: "binaries.restic", Message: "can't find restic version"})
+			} else {
+				Utils.GetLogger().Info("Restic version " + resticVersions[1] + " found !")
+			}
 		}
-		os.Exit(1)
 	}
+	return errs
+}
+
+// Masked returns a copy of the configuration where every secret is hidden.
+func (b *BackupConfig) Masked() (*BackupConfig, error) {
+	content, err := yaml.Marshal(b)
+	if err != nil {
+		return nil, err
+	}
+	masked := &BackupConfig{}
+	if err := yaml.Unmarshal(content, masked); err != nil {
+		return nil, err
+	}
+	maskSecrets(reflect.ValueOf(masked))
+	return masked, nil
+}
 
-	_, err := os.Stat(c.BackupConfig.Binaries.Restic)
-	Utils.HaltOnError(Utils.GetLogger(), err, "")
+func defaultStateDir() string {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "gobackup")
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".local", "state", "gobackup")
+	}
+	return ".gobackup"
+}
 
-	result, err := Utils.ExecuteCommand(c.BackupConfig.Binaries.Restic + " version")
-	Utils.GetLogger().Debug("Version: ", result.Output)
-	Utils.HaltOnError(Utils.GetLogger(), err, "")
+// Secrets returns the secret values of the configuration, to mask them in outputs.
+func (c *Config) Secrets() []string {
+	secrets := collectSecrets(reflect.ValueOf(c.BackupConfig))
+	if c.ResticPassword != "" {
+		secrets = append(secrets, c.ResticPassword)
+	}
+	return secrets
+}
 
-	if resticVersions := Utils.ResticVersionReg.FindStringSubmatch(result.Output); len(resticVersions) == 0 {
-		Utils.HaltOnError(Utils.GetLogger(), nil, "Can't find restic")
-	} else {
-		Utils.GetLogger().Info("Restic version " + resticVersions[1] + " found !")
+func (b *BackupConfig) validateCheck() ValidationErrors {
+	errs := make(ValidationErrors, 0)
+	if subset := b.Check.ReadDataSubset; subset != "" && !readDataSubsetReg.MatchString(subset) {
+		errs = append(errs, ValidationError{
+			Field:   "check.read_data_subset",
+			Message: fmt.Sprintf("'%s' must be a percentage (5%%), a slice (1/12) or a size (500M)", subset),
+		})
+	}
+	if b.Check.ReadDataSlices < 0 {
+		errs = append(errs, ValidationError{Field: "check.read_data_slices", Message: "must be greater than 0"})
 	}
+	if b.Check.ReadDataSubset != "" && b.Check.ReadDataSlices > 0 {
+		errs = append(errs, ValidationError{Field: "check", Message: "read_data_subset and read_data_slices can't be used together"})
+	}
+	return errs
+}
 
-	if c.BackupConfig.Information.ExclusionFile != "" {
-		_, err := os.Stat(c.BackupConfig.Information.ExclusionFile)
-		Utils.HaltOnError(Utils.GetLogger(), err, "Does the exclusion file exists ?")
+// validateDrill rejects the paths with spaces, the restore and dump commands are split on spaces.
+func (b *BackupConfig) validateDrill() ValidationErrors {
+	errs := make(ValidationErrors, 0)
+	for i, path := range b.Drill.Paths {
+		if path == "" || strings.ContainsAny(path, " \t") {
+			errs = append(errs, ValidationError{
+				Field:   fmt.Sprintf("drill.paths[%d]", i),
+				Message: fmt.Sprintf("'%s' must be a path without spaces", path),
+			})
+		}
 	}
+	return errs
 }
 
-func _checkRequiredFields(backupConfig *BackupConfig, callback func(string, string)) bool {
-	isValid := true
-	bckCfgType := reflect.ValueOf(*backupConfig)
+func (b *BackupConfig) setDefaults() {
+	if b.Forget.Cadence == "" {
+		b.Forget.Cadence = AlwaysCadence
+	}
+	if b.Prune.Cadence == "" {
+		b.Prune.Cadence = AlwaysCadence
+	}
+	if b.Check.Cadence == "" {
+		b.Check.Cadence = AlwaysCadence
+	}
+	if b.Drill.Cadence == "" {
+		b.Drill.Cadence = NeverCadence
+	}
+	if b.Stats.Cadence == "" {
+		b.Stats.Cadence = NeverCadence
+	}
+	if b.Diff.Top <= 0 {
+		b.Diff.Top = 10
+	}
+	if b.Drill.SampleSize <= 0 {
+		b.Drill.SampleSize = 5
+	}
+	if b.StateDir == "" {
+		b.StateDir = defaultStateDir()
+	}
+	b.Output.setDefaults(b.StateDir)
+	if len(b.ResticOptions) == 0 {
+		b.ResticOptions = append([]string{}, Utils.DefaultResticOptions...)
+	}
+	if b.Email.MaxTry == 0 {
+		b.Email.MaxTry = 1
+	}
 
-	for i := 0; i < bckCfgType.NumField(); i++ {
-		if bckCfgType.Type().Field(i).Type.Kind() == reflect.Struct {
-			tmp := reflect.ValueOf(bckCfgType.Field(i).Interface())
-			for j := 0; j < tmp.NumField(); j++ {
-				if tmp.Type().Field(j).Tag.Get("required") == "true" && tmp.Field(j).String() == "" {
-					callback(
-						bckCfgType.Type().Field(i).Name+"->"+tmp.Type().Field(j).Name,
-						bckCfgType.Type().Field(i).Tag.Get("yaml")+"."+tmp.Type().Field(j).Tag.Get("yaml"),
-					)
-					isValid = false
-				}
+	// pre_exec and post_exec are kept for compatibility, a failing pre_exec aborts the backup
+	if b.Backup.PreExecution != "" {
+		b.Hooks.PreBackup = append([]Hook{{
+			Name:         "pre_exec",
+			Command:      b.Backup.PreExecution,
+			AbortOnError: true,
+		}}, b.Hooks.PreBackup...)
+		b.Backup.PreExecution = ""
+	}
+	if b.Backup.PostExecution != "" {
+		b.Hooks.PostBackup = append([]Hook{{
+			Name:    "post_exec",
+			Command: b.Backup.PostExecution,
+		}}, b.Hooks.PostBackup...)
+		b.Backup.PostExecution = ""
+	}
+	for _, hooks := range [][]Hook{b.Hooks.PreBackup, b.Hooks.PostBackup, b.Hooks.OnSuccess, b.Hooks.OnFailure, b.Hooks.Always} {
+		for i := range hooks {
+			if fields := strings.Fields(hooks[i].Command); hooks[i].Name == "" && len(fields) > 0 {
+				hooks[i].Name = fmt.Sprintf("%s-%d", filepath.Base(fields[0]), i+1)
 			}
 		}
 	}
-	return isValid
 }
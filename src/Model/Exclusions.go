@@ -0,0 +1,110 @@
+package Model
+
+import (
+	"fmt"
+	"gobackup/src/Utils"
+	"strings"
+)
+
+// Exclusions are the restic options selecting the files of the folders, the
+// ones of a job are added to the shared ones.
+type Exclusions struct {
+	ExcludeFile       []string `yaml:"exclude_file"`
+	Exclude           []string `yaml:"exclude"`
+	IExclude          []string `yaml:"iexclude"`
+	ExcludeIfPresent  []string `yaml:"exclude_if_present"`
+	ExcludeCaches     bool     `yaml:"exclude_caches"`
+	ExcludeLargerThan string   `yaml:"exclude_larger_than" validate:"size"`
+	OneFileSystem     bool     `yaml:"one_file_system"`
+}
+
+func (e Exclusions) validate() ValidationErrors {
+	errs := make(ValidationErrors, 0)
+	for i, file := range e.ExcludeFile {
+		errs = append(errs, validatePatternFile(fmt.Sprintf("exclude_file[%d]", i), file)...)
+	}
+	for i, pattern := range e.Exclude {
+		errs = append(errs, validatePattern(fmt.Sprintf("exclude[%d]", i), pattern)...)
+	}
+	for i, pattern := range e.IExclude {
+		errs = append(errs, validatePattern(fmt.Sprintf("iexclude[%d]", i), pattern)...)
+	}
+	for i, name := range e.ExcludeIfPresent {
+		if name == "" || strings.ContainsAny(name, " \t") {
+			errs = append(errs, ValidationError{Field: fmt.Sprintf("exclude_if_present[%d]", i), Message: fmt.Sprintf("'%s' is not a valid file name", name)})
+		}
+	}
+	return errs
+}
+
+func validatePattern(field string, pattern string) ValidationErrors {
+	if strings.ContainsAny(pattern, " \t") {
+		return ValidationErrors{{Field: field, Message: fmt.Sprintf("'%s' contains spaces, use ? or an exclude_file", pattern)}}
+	}
+	if err := Utils.ValidatePattern(pattern); err != nil {
+		return ValidationErrors{{Field: field, Message: err.Error()}}
+	}
+	return nil
+}
+
+// validatePatternFile checks every pattern of an exclusion file.
+func validatePatternFile(field string, file string) ValidationErrors {
+	patterns, err := Utils.ReadPatternFile(file)
+	if err != nil {
+		return ValidationErrors{{Field: field, Message: fmt.Sprintf("file '%s' can't be read", file)}}
+	}
+	errs := make(ValidationErrors, 0)
+	for _, pattern := range patterns {
+		if err := Utils.ValidatePattern(pattern); err != nil {
+			errs = append(errs, ValidationError{Field: field, Message: fmt.Sprintf("%s: %s", file, err)})
+		}
+	}
+	return errs
+}
+
+// JobExclusions merges the exclusions of the job with the shared ones, the
+// exclusion file of the information section comes first.
+func (b *BackupConfig) JobExclusions(job *Job) Exclusions {
+	exclusions := Exclusions{
+		ExcludeFile:       appendUnique(nil, b.Exclusions.ExcludeFile...),
+		Exclude:           appendUnique(nil, b.Exclusions.Exclude...),
+		IExclude:          appendUnique(nil, b.Exclusions.IExclude...),
+		ExcludeIfPresent:  appendUnique(nil, b.Exclusions.ExcludeIfPresent...),
+		ExcludeCaches:     b.Exclusions.ExcludeCaches,
+		ExcludeLargerThan: b.Exclusions.ExcludeLargerThan,
+		OneFileSystem:     b.Exclusions.OneFileSystem,
+	}
+	if file := b.Information.ExclusionFile; file != "" {
+		exclusions.ExcludeFile = appendUnique([]string{file}, exclusions.ExcludeFile...)
+	}
+	if job == nil {
+		return exclusions
+	}
+	own := job.Exclusions
+	exclusions.ExcludeFile = appendUnique(exclusions.ExcludeFile, own.ExcludeFile...)
+	exclusions.Exclude = appendUnique(exclusions.Exclude, own.Exclude...)
+	exclusions.IExclude = appendUnique(exclusions.IExclude, own.IExclude...)
+	exclusions.ExcludeIfPresent = appendUnique(exclusions.ExcludeIfPresent, own.ExcludeIfPresent...)
+	exclusions.ExcludeCaches = exclusions.ExcludeCaches || own.ExcludeCaches
+	exclusions.OneFileSystem = exclusions.OneFileSystem || own.OneFileSystem
+	if own.ExcludeLargerThan != "" {
+		exclusions.ExcludeLargerThan = own.ExcludeLargerThan
+	}
+	return exclusions
+}
+
+func appendUnique(values []string, others ...string) []string {
+	for _, other := range others {
+		found := false
+		for _, value := range values {
+			if value == other {
+				found = true
+				break
+			}
+		}
+		if !found {
+			values = append(values, other)
+		}
+	}
+	return values
+}
@@ -0,0 +1,76 @@
+package Model
+
+import (
+	"errors"
+	"gobackup/src/Utils"
+)
+
+const (
+	LocalExecutor  = "local"
+	SSHExecutor    = "ssh"
+	DockerExecutor = "docker"
+	ScriptExecutor = "script"
+)
+
+// Executor is where the commands of a job run: restic, the dumps and the hooks.
+type Executor struct {
+	Type string `yaml:"type" validate:"oneof=local|ssh|docker|script"`
+	// Host is the ssh destination, like backup@appliance.example.com
+	Host         string   `yaml:"host"`
+	Port         int      `yaml:"port" validate:"port"`
+	IdentityFile string   `yaml:"identity_file" validate:"file"`
+	Options      []string `yaml:"options"`
+	Container    string   `yaml:"container"`
+	User         string   `yaml:"user"`
+	// Binary replaces ssh or docker, podman for instance
+	Binary string `yaml:"binary"`
+	// Script is the yaml file answering the commands of the script executor
+	Script string `yaml:"script" validate:"file"`
+}
+
+func (e Executor) validate() ValidationErrors {
+	errs := make(ValidationErrors, 0)
+	switch e.Type {
+	case SSHExecutor:
+		if e.Host == "" {
+			errs = append(errs, ValidationError{Field: "host", Message: "is required with the ssh executor"})
+		}
+	case DockerExecutor:
+		if e.Container == "" {
+			errs = append(errs, ValidationError{Field: "container", Message: "is required with the docker executor"})
+		}
+	case ScriptExecutor:
+		if e.Script == "" {
+			errs = append(errs, ValidationError{Field: "script", Message: "is required with the script executor"})
+		} else if _, err := Utils.LoadScriptedExecutor(e.Script); err != nil {
+			errs = append(errs, ValidationError{Field: "script", Message: err.Error()})
+		}
+	}
+	return errs
+}
+
+func (e Executor) IsLocal() bool {
+	return e.Type == "" || e.Type == LocalExecutor
+}
+
+func (e Executor) New() (Utils.Executor, error) {
+	switch e.Type {
+	case "", LocalExecutor:
+		return Utils.NewLocalExecutor(), nil
+	case SSHExecutor:
+		return Utils.NewSSHExecutor(e.Host, e.Port, e.IdentityFile, e.Options, e.Binary), nil
+	case DockerExecutor:
+		return Utils.NewDockerExecutor(e.Container, e.User, e.Binary), nil
+	case ScriptExecutor:
+		return Utils.LoadScriptedExecutor(e.Script)
+	}
+	return nil, errors.New("unknown executor '" + e.Type + "'")
+}
+
+// JobExecutor returns the executor of the job, or the one of the configuration.
+func (b *BackupConfig) JobExecutor(job *Job) Executor {
+	if job != nil && job.Executor != nil {
+		return *job.Executor
+	}
+	return b.Executor
+}
@@ -0,0 +1,344 @@
+package Model
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v2"
+	yaml3 "gopkg.in/yaml.v3"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const includeKey = "include"
+
+type configFragment struct {
+	Filename string
+	Content  []byte
+	Document yaml.MapSlice
+}
+
+// readConfigFragments returns the fragments to merge for a path, in order.
+// A directory contributes all its yaml files in lexical order, a file
+// contributes its includes first and then itself.
+func readConfigFragments(path string, visited map[string]bool) ([]configFragment, ValidationErrors) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, ValidationErrors{{File: path, Message: err.Error()}}
+	}
+	if info.IsDir() {
+		return readConfigDir(path, visited)
+	}
+
+	absPath, _ := filepath.Abs(path)
+	if visited[absPath] {
+		return nil, ValidationErrors{{File: path, Message: "include cycle detected"}}
+	}
+	visited[absPath] = true
+	defer delete(visited, absPath)
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, ValidationErrors{{File: path, Message: err.Error()}}
+	}
+	fragment := configFragment{Filename: path, Content: content}
+	if err := yaml.Unmarshal(content, &fragment.Document); err != nil {
+		return nil, yamlError(err).inFile(path)
+	}
+
+	fragments := make([]configFragment, 0)
+	errs := make(ValidationErrors, 0)
+	includes, err := fragmentIncludes(fragment.Document)
+	if err != nil {
+		errs = append(errs, ValidationError{File: path, Field: includeKey, Message: err.Error()})
+	}
+	for _, include := range includes {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(path), include)
+		}
+		matches, err := filepath.Glob(include)
+		if err != nil || len(matches) == 0 {
+			errs = append(errs, ValidationError{File: path, Field: includeKey, Message: fmt.Sprintf("no file matches '%s'", include)})
+			continue
+		}
+		sort.Strings(matches)
+		for _, match := range matches {
+			included, includeErrs := readConfigFragments(match, visited)
+			fragments = append(fragments, included...)
+			errs = append(errs, includeErrs...)
+		}
+	}
+	return append(fragments, fragment), errs
+}
+
+func readConfigDir(dir string, visited map[string]bool) ([]configFragment, ValidationErrors) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, ValidationErrors{{File: dir, Message: err.Error()}}
+	}
+	fragments := make([]configFragment, 0)
+	errs := make(ValidationErrors, 0)
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || (ext != ".yml" && ext != ".yaml") {
+			continue
+		}
+		dirFragments, dirErrs := readConfigFragments(filepath.Join(dir, entry.Name()), visited)
+		fragments = append(fragments, dirFragments...)
+		errs = append(errs, dirErrs...)
+	}
+	return fragments, errs
+}
+
+func fragmentIncludes(document yaml.MapSlice) ([]string, error) {
+	for _, item := range document {
+		if item.Key != includeKey {
+			continue
+		}
+		switch value := item.Value.(type) {
+		case nil:
+			return nil, nil
+		case string:
+			return []string{value}, nil
+		case []interface{}:
+			includes := make([]string, 0, len(value))
+			for _, include := range value {
+				path, ok := include.(string)
+				if !ok {
+					return nil, fmt.Errorf("must be a list of paths")
+				}
+				includes = append(includes, path)
+			}
+			return includes, nil
+		default:
+			return nil, fmt.Errorf("must be a path or a list of paths")
+		}
+	}
+	return nil, nil
+}
+
+// namedLists are merged item by item on the name of their items, so the jobs
+// and the hooks can be spread over the fragments.
+var namedLists = map[string]bool{
+	"jobs":              true,
+	"hooks.pre_backup":  true,
+	"hooks.post_backup": true,
+	"hooks.on_success":  true,
+	"hooks.on_failure":  true,
+	"hooks.always":      true,
+}
+
+// mergeDocuments deep merges src into dst: mappings are merged key by key,
+// the items of the named lists are merged with the item of the same name or
+// appended, any other value (scalars and lists) from src replaces the one in
+// dst. moved gets the path in dst of the items of the named lists of src.
+func mergeDocuments(dst yaml.MapSlice, src yaml.MapSlice, moved map[string]string) yaml.MapSlice {
+	return mergeMapping(dst, src, "", moved)
+}
+
+func mergeMapping(dst yaml.MapSlice, src yaml.MapSlice, path string, moved map[string]string) yaml.MapSlice {
+	for _, item := range src {
+		if path == "" && item.Key == includeKey {
+			continue
+		}
+		itemPath := joinPath(path, fmt.Sprint(item.Key))
+		found := false
+		for i := range dst {
+			if dst[i].Key != item.Key {
+				continue
+			}
+			found = true
+			dstMap, dstOk := dst[i].Value.(yaml.MapSlice)
+			srcMap, srcOk := item.Value.(yaml.MapSlice)
+			dstList, dstListOk := dst[i].Value.([]interface{})
+			srcList, srcListOk := item.Value.([]interface{})
+			if dstOk && srcOk {
+				dst[i].Value = mergeMapping(dstMap, srcMap, itemPath, moved)
+			} else if dstListOk && srcListOk && namedLists[itemPath] {
+				dst[i].Value = mergeNamedList(dstList, srcList, itemPath, moved)
+			} else {
+				dst[i].Value = item.Value
+			}
+			break
+		}
+		if !found {
+			dst = append(dst, item)
+		}
+	}
+	return dst
+}
+
+func mergeNamedList(dst []interface{}, src []interface{}, path string, moved map[string]string) []interface{} {
+	for i, item := range src {
+		index := -1
+		if name := itemName(item); name != "" {
+			for j := range dst {
+				if itemName(dst[j]) == name {
+					index = j
+					break
+				}
+			}
+		}
+		if index < 0 {
+			dst = append(dst, item)
+			index = len(dst) - 1
+		} else {
+			dstItem, _ := dst[index].(yaml.MapSlice)
+			srcItem, _ := item.(yaml.MapSlice)
+			dst[index] = mergeMapping(dstItem, srcItem, fmt.Sprintf("%s[%d]", path, index), moved)
+		}
+		if moved != nil {
+			moved[fmt.Sprintf("%s[%d]", path, i)] = fmt.Sprintf("%s[%d]", path, index)
+		}
+	}
+	return dst
+}
+
+// itemName returns the name of a list item, empty when it has none.
+func itemName(item interface{}) string {
+	mapping, ok := item.(yaml.MapSlice)
+	if !ok {
+		return ""
+	}
+	for _, field := range mapping {
+		if field.Key == "name" {
+			if name, ok := field.Value.(string); ok {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+func (e ValidationErrors) inFile(filename string) ValidationErrors {
+	for i := range e {
+		e[i].File = filename
+	}
+	return e
+}
+
+type keyOrigin struct {
+	File string
+	Line int
+}
+
+// keyLines returns the line of every key and list item of a yaml document,
+// by their path in the errors: jobs[0].tags[1].
+func keyLines(content []byte) map[string]int {
+	lines := make(map[string]int)
+	var document yaml3.Node
+	if err := yaml3.Unmarshal(content, &document); err != nil || len(document.Content) == 0 {
+		return lines
+	}
+	addNodeLines(lines, document.Content[0], "")
+	return lines
+}
+
+func addNodeLines(lines map[string]int, node *yaml3.Node, path string) {
+	switch node.Kind {
+	case yaml3.AliasNode:
+		addNodeLines(lines, node.Alias, path)
+	case yaml3.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			// The keys merged from an anchor are given the lines of the anchor
+			if key.Tag == "!!merge" {
+				merged := []*yaml3.Node{value}
+				if value.Kind == yaml3.SequenceNode {
+					merged = value.Content
+				}
+				for _, anchor := range merged {
+					addNodeLines(lines, anchor, path)
+				}
+				continue
+			}
+			keyPath := joinPath(path, key.Value)
+			lines[keyPath] = key.Line
+			addNodeLines(lines, value, keyPath)
+		}
+	case yaml3.SequenceNode:
+		for i, item := range node.Content {
+			itemPath := fmt.Sprintf("%s[%d]", path, i)
+			lines[itemPath] = item.Line
+			addNodeLines(lines, item, itemPath)
+		}
+	}
+}
+
+// addOrigins records the file and line of the keys of a fragment, a list
+// replaces the items of the previous fragments, except the named lists.
+func addOrigins(origins map[string]keyOrigin, fragment configFragment, moved map[string]string) {
+	lines := make(map[string]int)
+	for path, line := range keyLines(fragment.Content) {
+		if path != includeKey && !strings.HasPrefix(path, includeKey+"[") {
+			lines[movedPath(path, moved)] = line
+		}
+	}
+	for path := range lines {
+		if namedLists[path] {
+			continue
+		}
+		for existing := range origins {
+			if strings.HasPrefix(existing, path+"[") {
+				delete(origins, existing)
+			}
+		}
+	}
+	for path, line := range lines {
+		origins[path] = keyOrigin{File: fragment.Filename, Line: line}
+	}
+}
+
+// movedPath returns the path in the merged document of a path of a fragment.
+func movedPath(path string, moved map[string]string) string {
+	for from, to := range moved {
+		if path == from || strings.HasPrefix(path, from+".") || strings.HasPrefix(path, from+"[") {
+			return to + strings.TrimPrefix(path, from)
+		}
+	}
+	return path
+}
+
+// atKeys replaces the lines of the errors in the merged document by the path
+// of their key, the most precise one when several keys share the line.
+func (e ValidationErrors) atKeys(lines map[string]int) ValidationErrors {
+	for i := range e {
+		if e[i].Line == 0 || e[i].File != "" {
+			continue
+		}
+		if e[i].Field == "" {
+			for path, line := range lines {
+				if line == e[i].Line && len(path) > len(e[i].Field) {
+					e[i].Field = path
+				}
+			}
+		}
+		e[i].Line = 0
+	}
+	return e
+}
+
+// withOrigins gives the errors without a file the file and line of their
+// key, or of the closest parent key when the key is missing.
+func (e ValidationErrors) withOrigins(origins map[string]keyOrigin) ValidationErrors {
+	for i := range e {
+		if e[i].File != "" {
+			continue
+		}
+		for path := e[i].Field; path != ""; path = parentPath(path) {
+			if origin, ok := origins[path]; ok {
+				e[i].File, e[i].Line = origin.File, origin.Line
+				break
+			}
+		}
+	}
+	return e
+}
+
+func parentPath(path string) string {
+	if i := strings.LastIndexAny(path, ".["); i >= 0 {
+		return path[:i]
+	}
+	return ""
+}
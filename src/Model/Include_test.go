@@ -0,0 +1,307 @@
+package Model
+
+import (
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeFiles creates the files, by their path relative to the directory.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMergeDocuments(t *testing.T) {
+	var dst, src yaml.MapSlice
+	if err := yaml.Unmarshal([]byte("a: 1\nb:\n  c: 2\n  d: 3\nl: [1, 2]\n"), &dst); err != nil {
+		t.Fatal(err)
+	}
+	if err := yaml.Unmarshal([]byte("include: other.yml\nb:\n  d: 4\n  e: 5\nl: [3]\nf: 6\n"), &src); err != nil {
+		t.Fatal(err)
+	}
+	merged, err := yaml.Marshal(mergeDocuments(dst, src, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "a: 1\nb:\n  c: 2\n  d: 4\n  e: 5\nl:\n- 3\nf: 6\n"
+	if string(merged) != expected {
+		t.Errorf("merged:\n%s\nexpected:\n%s", merged, expected)
+	}
+}
+
+func TestReadConfigFragments(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"main.yml":            "include: [base.yml, 'jobs/*.yml']\nstate_dir: /main\n",
+		"base.yml":            "state_dir: /base\n",
+		"jobs/b.yml":          "jobs: []\n",
+		"jobs/a.yml":          "jobs: []\n",
+		"conf.d/20-last.yml":  "state_dir: /last\n",
+		"conf.d/10-first.yml": "include: ../base.yml\n",
+		"conf.d/notes.txt":    "not: yaml: at all\n",
+	})
+
+	for _, test := range []struct {
+		path     string
+		expected []string
+	}{
+		{"main.yml", []string{"base.yml", "jobs/a.yml", "jobs/b.yml", "main.yml"}},
+		{"conf.d", []string{"base.yml", "conf.d/10-first.yml", "conf.d/20-last.yml"}},
+	} {
+		fragments, errs := readConfigFragments(filepath.Join(dir, test.path), make(map[string]bool))
+		if len(errs) > 0 {
+			t.Fatalf("%s: %v", test.path, errs)
+		}
+		names := make([]string, 0)
+		for _, fragment := range fragments {
+			name, _ := filepath.Rel(dir, filepath.Clean(fragment.Filename))
+			names = append(names, filepath.ToSlash(name))
+		}
+		if !reflect.DeepEqual(names, test.expected) {
+			t.Errorf("%s: fragments %v, expected %v", test.path, names, test.expected)
+		}
+	}
+}
+
+func TestIncludeCycle(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"a.yml":      "include: b.yml\n",
+		"b.yml":      "include: c.yml\n",
+		"c.yml":      "include: a.yml\n",
+		"shared.yml": "state_dir: /shared\n",
+		"d.yml":      "include: [shared.yml, shared.yml]\n",
+	})
+
+	_, errs := readConfigFragments(filepath.Join(dir, "a.yml"), make(map[string]bool))
+	if len(errs) != 1 || errs[0].Message != "include cycle detected" || filepath.Base(errs[0].File) != "a.yml" {
+		t.Errorf("unexpected errors %v", errs)
+	}
+
+	// Including a file twice is not a cycle
+	fragments, errs := readConfigFragments(filepath.Join(dir, "d.yml"), make(map[string]bool))
+	if len(errs) > 0 || len(fragments) != 3 {
+		t.Errorf("%d fragments, errors %v", len(fragments), errs)
+	}
+}
+
+func TestMissingInclude(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"main.yml": "include: missing/*.yml\n"})
+
+	_, errs := readConfigFragments(filepath.Join(dir, "main.yml"), make(map[string]bool))
+	if len(errs) != 1 || errs[0].Field != includeKey || !strings.Contains(errs[0].Message, "no file matches") {
+		t.Errorf("unexpected errors %v", errs)
+	}
+}
+
+func TestLoadBackupConfigOrigins(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"script.yml": "[]\n",
+		"conf.d/10-base.yml": `information:
+  server_name: web1
+  rclone_connection_name: remote
+  bucket_name: bucket
+binaries:
+  restic: restic
+executor:
+  type: script
+  script: ` + filepath.Join(dir, "script.yml") + `
+jobs:
+  - name: files
+    repository: Files
+    folders: [/data]
+`,
+		"conf.d/20-override.yml": `# the repository of the host
+repository:
+  compression: fast
+`,
+	})
+
+	config := &Config{}
+	err := config.LoadBackupConfig(filepath.Join(dir, "conf.d"))
+	errs, ok := err.(ValidationErrors)
+	if !ok || len(errs) != 1 {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if errs[0].Field != "repository.compression" || filepath.Base(errs[0].File) != "20-override.yml" || errs[0].Line != 3 {
+		t.Errorf("unexpected error %+v", errs[0])
+	}
+}
+
+func TestKeyLines(t *testing.T) {
+	content := `jobs:
+  - name: files
+    tags:
+      - daily
+      - "db"
+    description: |
+      name: not a key
+  - name: db
+hooks:
+  pre_backup: []
+`
+	expected := map[string]int{
+		"jobs":                1,
+		"jobs[0]":             2,
+		"jobs[0].name":        2,
+		"jobs[0].tags":        3,
+		"jobs[0].tags[0]":     4,
+		"jobs[0].tags[1]":     5,
+		"jobs[0].description": 6,
+		"jobs[1]":             8,
+		"jobs[1].name":        8,
+		"hooks":               9,
+		"hooks.pre_backup":    10,
+	}
+	if lines := keyLines([]byte(content)); !reflect.DeepEqual(lines, expected) {
+		t.Errorf("lines %v, expected %v", lines, expected)
+	}
+}
+
+func TestKeyLinesFlowAndAnchors(t *testing.T) {
+	content := `defaults: &defaults
+  repository: Files
+  tags: [daily]
+jobs:
+  - {name: files, folders: [/data]}
+  - <<: *defaults
+    name: other
+---
+ignored: true
+`
+	expected := map[string]int{
+		"defaults":            1,
+		"defaults.repository": 2,
+		"defaults.tags":       3,
+		"defaults.tags[0]":    3,
+		"jobs":                4,
+		"jobs[0]":             5,
+		"jobs[0].name":        5,
+		"jobs[0].folders":     5,
+		"jobs[0].folders[0]":  5,
+		"jobs[1]":             6,
+		"jobs[1].repository":  2,
+		"jobs[1].tags":        3,
+		"jobs[1].tags[0]":     3,
+		"jobs[1].name":        7,
+	}
+	if lines := keyLines([]byte(content)); !reflect.DeepEqual(lines, expected) {
+		t.Errorf("lines %v, expected %v", lines, expected)
+	}
+}
+
+func TestLoadBackupConfigDecodeErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"script.yml": "[]\n",
+		"conf.d/10-base.yml": `information:
+  server_name: web1
+  rclone_connection_name: remote
+  bucket_name: bucket
+binaries:
+  restic: restic
+executor:
+  type: script
+  script: ` + filepath.Join(dir, "script.yml") + `
+`,
+		"conf.d/20-jobs.yml": `jobs:
+  - name: files
+    repository: Files
+    folders: [/data]
+    paralel: true
+email:
+  port: twenty-five
+`,
+	})
+
+	config := &Config{}
+	err := config.LoadBackupConfig(filepath.Join(dir, "conf.d"))
+	errs, ok := err.(ValidationErrors)
+	if !ok || len(errs) != 2 {
+		t.Fatalf("unexpected error %v", err)
+	}
+	expected := map[string]int{"jobs[0].paralel": 5, "email.port": 7}
+	for _, e := range errs {
+		if line, ok := expected[e.Field]; !ok || line != e.Line || filepath.Base(e.File) != "20-jobs.yml" {
+			t.Errorf("unexpected error %+v", e)
+		}
+	}
+}
+
+func TestLoadBackupConfigNamedLists(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"script.yml": "[]\n",
+		"conf.d/10-base.yml": `information:
+  server_name: web1
+  rclone_connection_name: remote
+  bucket_name: bucket
+binaries:
+  restic: restic
+executor:
+  type: script
+  script: ` + filepath.Join(dir, "script.yml") + `
+hooks:
+  pre_backup:
+    - name: mount
+      command: mount /data
+jobs:
+  - name: files
+    repository: Files
+    folders: [/data]
+`,
+		"conf.d/20-jobs.yml": `hooks:
+  pre_backup:
+    - name: dump
+      command: pg_dump
+jobs:
+  - name: db
+    repository: Db
+    folders: [/db]
+  - name: files
+    folders: [/srv]
+`,
+	})
+
+	config := &Config{}
+	if err := config.LoadBackupConfig(filepath.Join(dir, "conf.d")); err != nil {
+		t.Fatal(err)
+	}
+	jobs := config.BackupConfig.Jobs
+	if len(jobs) != 2 || jobs[0].Name != "files" || jobs[0].Repository != "Files" || !reflect.DeepEqual(jobs[0].Folders, []string{"/srv"}) || jobs[1].Name != "db" {
+		t.Errorf("unexpected jobs %+v", jobs)
+	}
+	var hooks []string
+	for _, hook := range config.BackupConfig.Hooks.PreBackup {
+		hooks = append(hooks, hook.Name)
+	}
+	if !reflect.DeepEqual(hooks[len(hooks)-2:], []string{"mount", "dump"}) {
+		t.Errorf("unexpected pre backup hooks %v", hooks)
+	}
+
+	// The errors of the merged items point to the fragment they come from
+	writeFiles(t, dir, map[string]string{"conf.d/30-db.yml": "jobs:\n  - name: db\n    paralel: true\n"})
+	err := (&Config{}).LoadBackupConfig(filepath.Join(dir, "conf.d"))
+	errs, ok := err.(ValidationErrors)
+	if !ok || len(errs) != 1 {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if errs[0].Field != "jobs[1].paralel" || filepath.Base(errs[0].File) != "30-db.yml" || errs[0].Line != 3 {
+		t.Errorf("unexpected error %+v", errs[0])
+	}
+}
@@ -0,0 +1,166 @@
+package Model
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	CommandSource   = "command"
+	PgDumpSource    = "pg_dump"
+	PgDumpAllSource = "pg_dumpall"
+	MysqlDumpSource = "mysqldump"
+)
+
+type Job struct {
+	Name       string       `yaml:"name" required:"true"`
+	Repository string       `yaml:"repository" required:"true"`
+	Folders    []string     `yaml:"folders"`
+	Sources    []Source     `yaml:"sources"`
+	CopyTo     []CopyTarget `yaml:"copy_to"`
+	// Bandwidth replaces the bandwidth limits of the configuration for this job
+	Bandwidth *Bandwidth `yaml:"bandwidth"`
+	// Resources replaces the resources of the configuration for this job
+	Resources *Resources `yaml:"resources"`
+	// Executor replaces the executor of the configuration for this job
+	Executor *Executor `yaml:"executor"`
+	// Tags are added to the snapshots, as is or rendered as templates
+	Tags []string `yaml:"tags"`
+	// Host replaces the host name recorded by restic
+	Host string `yaml:"host"`
+	// Retention replaces the retention rules of the configuration for this job
+	Retention *Retention `yaml:"retention"`
+	// Exclusions are added to the shared exclusions for this job
+	Exclusions Exclusions `yaml:",inline"`
+}
+
+// CopyTarget is a secondary repository receiving the snapshots of the job
+// through restic copy. The connection, bucket and repository default to the
+// ones of the job.
+type CopyTarget struct {
+	Name                 string `yaml:"name" required:"true"`
+	RCloneConnectionName string `yaml:"rclone_connection_name"`
+	BucketName           string `yaml:"bucket_name"`
+	Repository           string `yaml:"repository"`
+	// PasswordEnv is the environment variable holding the password of the
+	// secondary repository, the restic password is used when empty
+	PasswordEnv   string     `yaml:"password_env"`
+	ResticOptions []string   `yaml:"restic_opts"`
+	Bandwidth     *Bandwidth `yaml:"bandwidth"`
+}
+
+// Source is streamed into restic through --stdin, the standard output of the
+// command is saved in the snapshot as Filename.
+type Source struct {
+	Type     string `yaml:"type" required:"true" validate:"oneof=command|pg_dump|pg_dumpall|mysqldump"`
+	Filename string `yaml:"filename"`
+	Command  string `yaml:"command"`
+	Binary   string `yaml:"binary"`
+	Database string `yaml:"database"`
+	Options  string `yaml:"options"`
+	Password string `yaml:"password" secret:"true"`
+}
+
+func (s Source) validate() ValidationErrors {
+	errs := make(ValidationErrors, 0)
+	if s.Type == CommandSource && s.Command == "" {
+		errs = append(errs, ValidationError{Field: "command", Message: "is required when 'type' is " + CommandSource})
+	}
+	if s.Type == PgDumpSource && s.Database == "" {
+		errs = append(errs, ValidationError{Field: "database", Message: "is required when 'type' is " + PgDumpSource})
+	}
+	if strings.ContainsAny(s.Filename, " \t/") {
+		errs = append(errs, ValidationError{Field: "filename", Message: "must not contain spaces or slashes"})
+	}
+	return errs
+}
+
+// StdinFilename is the name of the file holding the source in the snapshot.
+func (s Source) StdinFilename() string {
+	if s.Filename != "" {
+		return s.Filename
+	}
+	switch s.Type {
+	case PgDumpSource, MysqlDumpSource:
+		if s.Database != "" {
+			return s.Database + ".sql"
+		}
+		return "all-databases.sql"
+	case PgDumpAllSource:
+		return "all-databases.sql"
+	}
+	return "stdin"
+}
+
+func (t CopyTarget) validate() ValidationErrors {
+	errs := make(ValidationErrors, 0)
+	if t.RCloneConnectionName == "" && t.BucketName == "" && t.Repository == "" {
+		errs = append(errs, ValidationError{Message: "rclone_connection_name, bucket_name or repository must differ from the job"})
+	}
+	return errs
+}
+
+// FindCopyTarget returns the secondary repository configured with this name.
+func (j *Job) FindCopyTarget(name string) (*CopyTarget, error) {
+	for i := range j.CopyTo {
+		if j.CopyTo[i].Name == name {
+			return &j.CopyTo[i], nil
+		}
+	}
+	return nil, fmt.Errorf("copy target '%s' not found in the job '%s'", name, j.Name)
+}
+
+// FindJob returns the job configured with this name.
+func (b *BackupConfig) FindJob(name string) (*Job, error) {
+	for i := range b.Jobs {
+		if b.Jobs[i].Name == name {
+			return &b.Jobs[i], nil
+		}
+	}
+	return nil, fmt.Errorf("job '%s' not found in the configuration", name)
+}
+
+// RepositoryJob returns the first job configured with this repository, with
+// its own executor, retention and limits. A repository without a job gets a
+// job of its own name.
+func (b *BackupConfig) RepositoryJob(repository string) *Job {
+	for i := range b.Jobs {
+		if b.Jobs[i].Repository == repository {
+			return &b.Jobs[i]
+		}
+	}
+	return &Job{Name: repository, Repository: repository}
+}
+
+// Repositories returns the repositories of the jobs, without duplicates.
+func (b *BackupConfig) Repositories() []string {
+	repositories := make([]string, 0, len(b.Jobs))
+	seen := make(map[string]bool)
+	for _, job := range b.Jobs {
+		if !seen[job.Repository] {
+			seen[job.Repository] = true
+			repositories = append(repositories, job.Repository)
+		}
+	}
+	return repositories
+}
+
+func (b *BackupConfig) validateJobs() ValidationErrors {
+	errs := make(ValidationErrors, 0)
+	names := make(map[string]bool)
+	for i, job := range b.Jobs {
+		if names[job.Name] {
+			errs = append(errs, ValidationError{Field: fmt.Sprintf("jobs[%d].name", i), Message: fmt.Sprintf("job '%s' is defined twice", job.Name)})
+		}
+		names[job.Name] = true
+		if len(job.Folders) == 0 && len(job.Sources) == 0 {
+			errs = append(errs, ValidationError{Field: fmt.Sprintf("jobs[%d]", i), Message: "at least one folder or source is required"})
+		}
+		for j, tag := range job.Tags {
+			if _, err := ParseTag(tag); err != nil {
+				errs = append(errs, ValidationError{Field: fmt.Sprintf("jobs[%d].tags[%d]", i, j), Message: err.Error()})
+			}
+		}
+	}
+	return errs
+}
@@ -0,0 +1,65 @@
+package Model
+
+import (
+	"gobackup/src/Utils"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Logging struct {
+	Format      string `yaml:"format" validate:"oneof=text|json"`
+	Level       string `yaml:"level" validate:"oneof=trace|debug|info|warn|warning|error"`
+	Destination string `yaml:"destination" validate:"oneof=stdout|stderr|file"`
+	File        string `yaml:"file"`
+	// MaxSize rotates the file, MaxAge and MaxBackups remove the rotated files
+	MaxSize    string        `yaml:"max_size" validate:"size"`
+	MaxAge     time.Duration `yaml:"max_age"`
+	MaxBackups int           `yaml:"max_backups"`
+	// RunDir keeps the logs of each run in its own file
+	RunDir string `yaml:"run_dir"`
+}
+
+func (l Logging) validate() ValidationErrors {
+	errs := make(ValidationErrors, 0)
+	if l.Destination == "file" && l.File == "" {
+		errs = append(errs, ValidationError{Field: "file", Message: "is required when 'destination' is file"})
+	}
+	if l.MaxBackups < 0 {
+		errs = append(errs, ValidationError{Field: "max_backups", Message: "must be positive"})
+	}
+	return errs
+}
+
+// LoggingOptions returns the logging configuration, the LOG_LEVEL environment
+// variable overrides the configured level.
+func (c *Config) LoggingOptions() Utils.LoggingOptions {
+	logging := c.BackupConfig.Logging
+	level := logging.Level
+	if _, ok := os.LookupEnv("LOG_LEVEL"); ok || level == "" || strings.ToLower(c.Environment) == "dev" {
+		level = c.LoggerLevel
+	}
+	return Utils.LoggingOptions{
+		Format:      logging.Format,
+		Level:       level,
+		Destination: logging.Destination,
+		File:        logging.File,
+		MaxSize:     sizeToBytes(logging.MaxSize),
+		MaxAge:      logging.MaxAge,
+		MaxBackups:  logging.MaxBackups,
+	}
+}
+
+func sizeToBytes(size string) int64 {
+	if size == "" {
+		return 0
+	}
+	multiplier := int64(1)
+	if unit := strings.IndexAny(size, "KMGT"); unit >= 0 {
+		multiplier = int64(1) << (10 * (strings.IndexByte("KMGT", size[unit]) + 1))
+		size = size[:unit]
+	}
+	value, _ := strconv.ParseInt(size, 10, 64)
+	return value * multiplier
+}
@@ -0,0 +1,48 @@
+package Model
+
+import (
+	"path/filepath"
+	"time"
+)
+
+// Output limits the output of the commands kept in memory and in the reports,
+// the whole output of the longer commands is saved in Dir.
+type Output struct {
+	// MaxLines is split between the first and the last lines, -1 keeps everything
+	MaxLines int           `yaml:"max_lines"`
+	Dir      string        `yaml:"dir"`
+	MaxAge   time.Duration `yaml:"max_age"`
+	// Attach sends the saved outputs with the email report
+	Attach bool `yaml:"attach"`
+}
+
+func (o Output) validate() ValidationErrors {
+	errs := make(ValidationErrors, 0)
+	if o.MaxLines < -1 {
+		errs = append(errs, ValidationError{Field: "max_lines", Message: "must be positive, or -1 to keep every line"})
+	}
+	if o.MaxAge < 0 {
+		errs = append(errs, ValidationError{Field: "max_age", Message: "must be positive"})
+	}
+	return errs
+}
+
+func (o *Output) setDefaults(stateDir string) {
+	if o.MaxLines == 0 {
+		o.MaxLines = 1000
+	}
+	if o.Dir == "" {
+		o.Dir = filepath.Join(stateDir, "output")
+	}
+	if o.MaxAge == 0 {
+		o.MaxAge = 30 * 24 * time.Hour
+	}
+}
+
+// Lines returns the number of lines kept by the commands, 0 keeps everything.
+func (o Output) Lines() int {
+	if o.MaxLines < 0 {
+		return 0
+	}
+	return o.MaxLines
+}
@@ -0,0 +1,37 @@
+package Model
+
+// Resources lowers the priority of the child processes and tunes restic, zero
+// values keep the defaults.
+type Resources struct {
+	Nice            int    `yaml:"nice"`
+	IoniceClass     string `yaml:"ionice_class" validate:"oneof=idle|best-effort|realtime"`
+	IoniceLevel     int    `yaml:"ionice_level"`
+	GoMaxProcs      int    `yaml:"gomaxprocs"`
+	GoGC            int    `yaml:"gogc"`
+	ReadConcurrency int    `yaml:"read_concurrency"`
+	// PackSize is the target pack size of restic in MiB
+	PackSize int `yaml:"pack_size"`
+}
+
+func (r Resources) validate() ValidationErrors {
+	errs := make(ValidationErrors, 0)
+	if r.Nice < -20 || r.Nice > 19 {
+		errs = append(errs, ValidationError{Field: "nice", Message: "must be between -20 and 19"})
+	}
+	if r.IoniceLevel < 0 || r.IoniceLevel > 7 {
+		errs = append(errs, ValidationError{Field: "ionice_level", Message: "must be between 0 and 7"})
+	}
+	if r.IoniceLevel > 0 && r.IoniceClass != "best-effort" && r.IoniceClass != "realtime" {
+		errs = append(errs, ValidationError{Field: "ionice_level", Message: "requires 'ionice_class' best-effort or realtime"})
+	}
+	fields := []string{"gomaxprocs", "read_concurrency", "pack_size"}
+	for i, value := range []int{r.GoMaxProcs, r.ReadConcurrency, r.PackSize} {
+		if value < 0 {
+			errs = append(errs, ValidationError{Field: fields[i], Message: "must be positive"})
+		}
+	}
+	if r.GoGC < -1 {
+		errs = append(errs, ValidationError{Field: "gogc", Message: "must be positive, or -1 to disable the garbage collector"})
+	}
+	return errs
+}
@@ -0,0 +1,70 @@
+package Model
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// TagFunctions are the functions of the tag templates, they are given their
+// implementation when the tags are rendered.
+var TagFunctions = template.FuncMap{
+	"date":    func(layout string) string { return "" },
+	"env":     func(name string) string { return "" },
+	"git":     func(dir string) string { return "" },
+	"command": func(command string) string { return "" },
+}
+
+// Retention applies another policy to the snapshots with some tags, the
+// policy of restic_opts is applied to the other snapshots.
+type Retention struct {
+	// GroupBy is given to restic forget, host,paths by default
+	GroupBy string          `yaml:"group_by"`
+	Rules   []RetentionRule `yaml:"rules"`
+}
+
+type RetentionRule struct {
+	// Tags must all be on a snapshot for the rule to apply
+	Tags []string `yaml:"tags" required:"true"`
+	Keep []string `yaml:"keep" required:"true"`
+}
+
+func (r Retention) validate() ValidationErrors {
+	errs := make(ValidationErrors, 0)
+	if r.GroupBy != "" {
+		for _, group := range strings.Split(r.GroupBy, ",") {
+			if group != "host" && group != "paths" && group != "tags" {
+				errs = append(errs, ValidationError{Field: "group_by", Message: fmt.Sprintf("'%s' is not one of host, paths, tags", group)})
+			}
+		}
+	}
+	return errs
+}
+
+func (r RetentionRule) validate() ValidationErrors {
+	errs := make(ValidationErrors, 0)
+	for _, tag := range r.Tags {
+		if tag == "" || strings.ContainsAny(tag, ", \t") {
+			errs = append(errs, ValidationError{Field: "tags", Message: fmt.Sprintf("'%s' is not a valid tag", tag)})
+		}
+	}
+	for _, keep := range r.Keep {
+		if !strings.HasPrefix(keep, "--keep-") || strings.ContainsAny(keep, " \t") {
+			errs = append(errs, ValidationError{Field: "keep", Message: fmt.Sprintf("'%s' must be a restic --keep-* option", keep)})
+		}
+	}
+	return errs
+}
+
+// ParseTag returns the template of a tag of a job.
+func ParseTag(tag string) (*template.Template, error) {
+	return template.New("tag").Funcs(TagFunctions).Option("missingkey=error").Parse(tag)
+}
+
+// JobRetention returns the retention of the job, or the one of the configuration.
+func (b *BackupConfig) JobRetention(job *Job) Retention {
+	if job != nil && job.Retention != nil {
+		return *job.Retention
+	}
+	return b.Retention
+}
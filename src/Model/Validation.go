@@ -0,0 +1,409 @@
+package Model
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	sizeReg             = regexp.MustCompile(`^\d+[KMGT]?$`)
+	maxUnusedReg        = regexp.MustCompile(`^(\d+(\.\d+)?%|\d+[KMGT]?|unlimited)$`)
+	yamlLineReg         = regexp.MustCompile(`^line (\d+): (.*)$`)
+	yamlUnknownFieldReg = regexp.MustCompile(`^line (\d+): field (\S+) not found in type`)
+)
+
+type ValidationError struct {
+	File    string
+	Field   string
+	Line    int
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	var prefix string
+	if e.File != "" && e.Line > 0 {
+		prefix += fmt.Sprintf("%s:%d: ", e.File, e.Line)
+	} else if e.File != "" {
+		prefix += e.File + ": "
+	} else if e.Line > 0 {
+		prefix += fmt.Sprintf("line %d: ", e.Line)
+	}
+	if e.Field != "" {
+		prefix += e.Field + ": "
+	}
+	return prefix + e.Message
+}
+
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "\n")
+}
+
+// decodeBackupConfig strictly decodes the yaml content and reports every type
+// error and unknown key, instead of stopping at the first one.
+func decodeBackupConfig(content []byte, backupConfig *BackupConfig) ValidationErrors {
+	errs := make(ValidationErrors, 0)
+
+	var document yaml.MapSlice
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return append(errs, yamlError(err)...)
+	}
+
+	unknownLines := make(map[string][]int)
+	err := yaml.UnmarshalStrict(content, backupConfig)
+	if typeErr, ok := err.(*yaml.TypeError); ok {
+		for _, msg := range typeErr.Errors {
+			if match := yamlUnknownFieldReg.FindStringSubmatch(msg); len(match) == 3 {
+				line, _ := strconv.Atoi(match[1])
+				unknownLines[match[2]] = append(unknownLines[match[2]], line)
+				continue
+			}
+			errs = append(errs, yamlError(fmt.Errorf("%s", msg))...)
+		}
+	} else if err != nil {
+		return append(errs, yamlError(err)...)
+	}
+
+	for _, unknown := range findUnknownKeys(document, reflect.TypeOf(*backupConfig), "") {
+		var line int
+		if lines := unknownLines[unknown.Key]; len(lines) > 0 {
+			line, unknownLines[unknown.Key] = lines[0], lines[1:]
+		}
+		message := "unknown key"
+		if unknown.Suggestion != "" {
+			message += fmt.Sprintf(", did you mean '%s' ?", unknown.Suggestion)
+		}
+		errs = append(errs, ValidationError{Field: unknown.Path, Line: line, Message: message})
+	}
+
+	sort.SliceStable(errs, func(i, j int) bool {
+		return errs[i].Line < errs[j].Line
+	})
+	return errs
+}
+
+func yamlError(err error) ValidationErrors {
+	msg := strings.TrimPrefix(err.Error(), "yaml: ")
+	if match := yamlLineReg.FindStringSubmatch(msg); len(match) == 3 {
+		line, _ := strconv.Atoi(match[1])
+		return ValidationErrors{{Line: line, Message: match[2]}}
+	}
+	return ValidationErrors{{Message: msg}}
+}
+
+type unknownKey struct {
+	Path       string
+	Key        string
+	Suggestion string
+}
+
+func findUnknownKeys(node interface{}, t reflect.Type, path string) []unknownKey {
+	unknowns := make([]unknownKey, 0)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		mapping, ok := node.(yaml.MapSlice)
+		if !ok {
+			return unknowns
+		}
+		fields := yamlFields(t)
+		for _, item := range mapping {
+			key := fmt.Sprint(item.Key)
+			if field, ok := fields[key]; ok {
+				unknowns = append(unknowns, findUnknownKeys(item.Value, field.Type, joinPath(path, key))...)
+				continue
+			}
+			candidates := make([]string, 0, len(fields))
+			for name := range fields {
+				candidates = append(candidates, name)
+			}
+			unknowns = append(unknowns, unknownKey{
+				Path:       joinPath(path, key),
+				Key:        key,
+				Suggestion: closestMatch(key, candidates),
+			})
+		}
+	case reflect.Slice:
+		items, ok := node.([]interface{})
+		if !ok {
+			return unknowns
+		}
+		for i, item := range items {
+			unknowns = append(unknowns, findUnknownKeys(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	case reflect.Map:
+		mapping, ok := node.(yaml.MapSlice)
+		if !ok {
+			return unknowns
+		}
+		for _, item := range mapping {
+			unknowns = append(unknowns, findUnknownKeys(item.Value, t.Elem(), joinPath(path, fmt.Sprint(item.Key)))...)
+		}
+	}
+	return unknowns
+}
+
+// validateStruct walks the configuration recursively and applies the rules
+// declared in the struct tags:
+//   - required:"true"         the value must be set
+//   - required_if:"<key>"     the value must be set when the sibling boolean <key> is true
+//   - validate:"port"         the value must be a valid TCP port
+//   - validate:"positive"     the value must be greater than zero
+//   - validate:"file"         the path must exist
+//   - validate:"oneof=a|b"    the value must be one of the listed values
+//   - validate:"size"         the value must be a size understood by restic (500M, 2G)
+//   - validate:"max_unused"   the value must be a percentage, a size or "unlimited"
+//   - validate:"rate"         the value must be a rate in KiB/s, or with a unit (512K, 2M, 1G)
+//
+// Structs implementing a validate() method can add their own rules.
+func validateStruct(v reflect.Value, path string) ValidationErrors {
+	errs := make(ValidationErrors, 0)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return errs
+		}
+		v = v.Elem()
+	}
+	t := v.Type()
+
+	if validator, ok := v.Interface().(interface{ validate() ValidationErrors }); ok {
+		for _, err := range validator.validate() {
+			err.Field = joinPath(path, err.Field)
+			errs = append(errs, err)
+		}
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if isInline(field) {
+			errs = append(errs, validateStruct(v.Field(i), path)...)
+			continue
+		}
+		key := yamlKey(field)
+		if key == "" {
+			continue
+		}
+		value := v.Field(i)
+		fieldPath := joinPath(path, key)
+
+		if field.Tag.Get("required") == "true" && value.IsZero() {
+			errs = append(errs, ValidationError{Field: fieldPath, Message: "is required"})
+			continue
+		}
+		if condition := field.Tag.Get("required_if"); condition != "" && value.IsZero() {
+			if sibling, ok := yamlFieldValue(v, condition); ok && sibling.Kind() == reflect.Bool && sibling.Bool() {
+				errs = append(errs, ValidationError{
+					Field:   fieldPath,
+					Message: fmt.Sprintf("is required when '%s' is true", joinPath(path, condition)),
+				})
+				continue
+			}
+		}
+		if !value.IsZero() {
+			if err := validateValue(field.Tag.Get("validate"), value); err != "" {
+				errs = append(errs, ValidationError{Field: fieldPath, Message: err})
+			}
+		}
+
+		switch value.Kind() {
+		case reflect.Struct, reflect.Ptr:
+			errs = append(errs, validateStruct(value, fieldPath)...)
+		case reflect.Slice:
+			for j := 0; j < value.Len(); j++ {
+				if item := value.Index(j); item.Kind() == reflect.Struct || item.Kind() == reflect.Ptr {
+					errs = append(errs, validateStruct(item, fmt.Sprintf("%s[%d]", fieldPath, j))...)
+				}
+			}
+		}
+	}
+	return errs
+}
+
+func validateValue(rule string, value reflect.Value) string {
+	if strings.HasPrefix(rule, "oneof=") {
+		allowed := strings.Split(strings.TrimPrefix(rule, "oneof="), "|")
+		for _, a := range allowed {
+			if value.String() == a {
+				return ""
+			}
+		}
+		return fmt.Sprintf("'%s' is not one of %s", value.String(), strings.Join(allowed, ", "))
+	}
+	switch rule {
+	case "port":
+		if port := value.Int(); port < 1 || port > 65535 {
+			return fmt.Sprintf("port %d is out of range (1-65535)", port)
+		}
+	case "positive":
+		if value.Int() <= 0 {
+			return "must be greater than 0"
+		}
+	case "size":
+		if !sizeReg.MatchString(value.String()) {
+			return fmt.Sprintf("'%s' must be a size (500M, 2G)", value.String())
+		}
+	case "max_unused":
+		if !maxUnusedReg.MatchString(value.String()) {
+			return fmt.Sprintf("'%s' must be a percentage (5%%), a size (500M) or unlimited", value.String())
+		}
+	case "rate":
+		if !rateReg.MatchString(value.String()) {
+			return fmt.Sprintf("'%s' must be a rate in KiB/s (512) or with a unit (512K, 2M, 1G)", value.String())
+		}
+	case "file":
+		if _, err := os.Stat(value.String()); err != nil {
+			return fmt.Sprintf("file '%s' does not exist", value.String())
+		}
+	}
+	return ""
+}
+
+// maskSecrets replaces every non empty field tagged with secret:"true".
+func maskSecrets(v reflect.Value) {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if field.Tag.Get("secret") == "true" && v.Field(i).Kind() == reflect.String && v.Field(i).String() != "" {
+				v.Field(i).SetString("********")
+				continue
+			}
+			maskSecrets(v.Field(i))
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			maskSecrets(v.Index(i))
+		}
+	}
+}
+
+// collectSecrets returns every non empty field tagged with secret:"true".
+func collectSecrets(v reflect.Value) []string {
+	secrets := make([]string, 0)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return secrets
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if field.Tag.Get("secret") == "true" && v.Field(i).Kind() == reflect.String && v.Field(i).String() != "" {
+				secrets = append(secrets, v.Field(i).String())
+				continue
+			}
+			secrets = append(secrets, collectSecrets(v.Field(i))...)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			secrets = append(secrets, collectSecrets(v.Index(i))...)
+		}
+	}
+	return secrets
+}
+
+func yamlKey(field reflect.StructField) string {
+	key := strings.Split(field.Tag.Get("yaml"), ",")[0]
+	if key == "-" {
+		return ""
+	}
+	return key
+}
+
+func yamlFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField)
+	for i := 0; i < t.NumField(); i++ {
+		if isInline(t.Field(i)) {
+			for key, field := range yamlFields(t.Field(i).Type) {
+				fields[key] = field
+			}
+		} else if key := yamlKey(t.Field(i)); key != "" {
+			fields[key] = t.Field(i)
+		}
+	}
+	return fields
+}
+
+// isInline tells if the fields of the struct are at the level of its parent.
+func isInline(field reflect.StructField) bool {
+	return field.Type.Kind() == reflect.Struct && strings.Contains(field.Tag.Get("yaml"), ",inline")
+}
+
+func yamlFieldValue(v reflect.Value, key string) (reflect.Value, bool) {
+	for i := 0; i < v.NumField(); i++ {
+		if yamlKey(v.Type().Field(i)) == key {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+func joinPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	if key == "" {
+		return path
+	}
+	return path + "." + key
+}
+
+func closestMatch(word string, candidates []string) string {
+	sort.Strings(candidates)
+	best, bestDistance := "", len(word)/3+2
+	for _, candidate := range candidates {
+		if distance := levenshtein(word, candidate); distance < bestDistance {
+			best, bestDistance = candidate, distance
+		}
+	}
+	return best
+}
+
+func levenshtein(a string, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(previous[j]+1, minInt(current[j-1]+1, previous[j-1]+cost))
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
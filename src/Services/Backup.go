@@ -1,7 +1,9 @@
 package Services
 
 import (
+	"context"
 	"fmt"
+	"github.com/sirupsen/logrus"
 	"gobackup/src/Model"
 	"gobackup/src/Utils"
 	"strconv"
@@ -12,8 +14,30 @@ import (
 
 type BackupManager struct {
 	Config      *Model.Config
+	Job         *Model.Job
+	State       *State
+	DryRun      bool
+	StartTime   time.Time
+	ReportTitle string
+	Drill       *DrillResult
+	Diffs       []*SnapshotDiff
+	Resources   *AppliedResources
+	// RepositorySize is only set when the statistics step ran
+	RepositorySize *RepositorySize
+	// OutputFiles are the whole outputs of the commands with skipped lines
+	OutputFiles []string
 	StepResults []BackupStepResult
 	LastResult  *BackupStepResult
+	// Executor runs the commands of the job, on this host by default
+	Executor Utils.Executor
+	// Host replaces the host name of the snapshots, and the one of the job
+	Host string
+
+	ctx         context.Context
+	logger      logrus.FieldLogger
+	step        string
+	tags        []string
+	tagWarnings []string
 }
 
 type BackupStatus int
@@ -21,6 +45,7 @@ type BackupStatus int
 const (
 	Success BackupStatus = 0
 	Failed  BackupStatus = 1
+	Warning BackupStatus = 2
 )
 
 func (s BackupStatus) String() string {
@@ -29,6 +54,8 @@ func (s BackupStatus) String() string {
 		return "success"
 	case Failed:
 		return "failed"
+	case Warning:
+		return "warning"
 	}
 	return "unknown"
 }
@@ -41,61 +68,46 @@ type BackupStepResult struct {
 	Duration  time.Duration
 }
 
+// resticIncompleteSnapshot is the exit code of restic backup when some files couldn't be read
+const resticIncompleteSnapshot = 3
+
 var backup *BackupManager
 
-func InitBackupManager(config *Model.Config, repository string, folders []string) *BackupManager {
+func InitBackupManager(config *Model.Config, job *Model.Job) *BackupManager {
 	var once sync.Once
 	once.Do(func() {
-		backup = &BackupManager{}
-		backup.Config = config
-		backup.Config.Repository = repository
-		backup.Config.FoldersToBackup = folders
+		backup = NewBackupManager(config, job, Utils.GetLogger())
 	})
 	return backup
 }
 
-func GetBackupManager() *BackupManager {
-	return backup
-}
-
-func (bm *BackupManager) ExecutePreCommand() (string, error) {
-	cmd := bm.Config.BackupConfig.Backup.PreExecution
-	if cmd != "" {
-		res, err := Utils.ExecuteCommand(cmd)
-		return res.Output, err
+// NewBackupManager returns a manager of the job, independent of the other
+// managers: the configuration is copied and the logs go to the given logger.
+func NewBackupManager(config *Model.Config, job *Model.Job, logger logrus.FieldLogger) *BackupManager {
+	jobConfig := *config
+	jobConfig.Repository = job.Repository
+	jobConfig.FoldersToBackup = job.Folders
+	bm := &BackupManager{
+		Config:    &jobConfig,
+		Job:       job,
+		StartTime: time.Now(),
+		logger:    logger,
 	}
-	return "", nil
-}
-
-func (bm *BackupManager) ExecutePostCommand() (string, error) {
-	cmd := bm.Config.BackupConfig.Backup.PostExecution
-	if cmd != "" {
-		res, err := Utils.ExecuteCommand(cmd)
-		return res.Output, err
+	executor, err := config.BackupConfig.JobExecutor(job).New()
+	if err != nil {
+		bm.log().Error("Impossible to create the executor: ", err)
+		executor = Utils.FailingExecutor{Err: err}
 	}
-	return "", nil
+	bm.Executor = executor
+	state, err := LoadState(config.BackupConfig.StateDir)
+	Utils.WarnOnError(bm.log(), err, "Impossible to load the state, scheduled tasks will run", nil)
+	bm.State = state
+	bm.initResources()
+	return bm
 }
 
-func (bm *BackupManager) InitRepo() {
-	result := BackupStepResult{
-		Name:      "Initialize Repository",
-		ShortName: "InitRepo",
-	}
-	Utils.GetLogger().Info(result.Name)
-	startTime := time.Now()
-	res, _ := bm.ExecuteRestic("init")
-	result.Output = res.Output
-	result.Status = Success
-
-	if res.ExitCode == 0 || (res.ExitCode == 1 && strings.Contains(res.Output, "already exists")) {
-		result.Status = Success
-	} else {
-		result.Status = Failed
-	}
-	endTime := time.Now()
-	result.Duration = endTime.Sub(startTime)
-	bm.StepResults = append(bm.StepResults, result)
-	bm.LastResult = &result
+func GetBackupManager() *BackupManager {
+	return backup
 }
 
 func (bm *BackupManager) StartBackup() {
@@ -103,16 +115,17 @@ func (bm *BackupManager) StartBackup() {
 		Name:      "Backing up",
 		ShortName: "StartBackup",
 	}
-	Utils.GetLogger().Info(result.Name)
-	if !isLastResultSuccess(bm.LastResult) {
+	if len(bm.Config.FoldersToBackup) == 0 {
 		return
 	}
-	startTime := time.Now()
-	var options string
-	if bm.Config.BackupConfig.Information.ExclusionFile != "" {
-		options += "--exclude-file=" + bm.Config.BackupConfig.Information.ExclusionFile
+	bm.logStep(&result)
+	if !bm.isLastResultSuccess() {
+		return
 	}
-	options += fmt.Sprintf(" --tag=%s", bm.Config.BackupConfig.Information.ServerName)
+	startTime := time.Now()
+	options := exclusionOptions(bm.Config.BackupConfig.JobExclusions(bm.Job))
+	tagOptions, tagWarnings := bm.tagOptions()
+	options += " " + tagOptions
 
 	var foldersToBackup []string
 	for _, f := range bm.Config.FoldersToBackup {
@@ -123,6 +136,13 @@ func (bm *BackupManager) StartBackup() {
 		}
 	}
 
+	if bm.Resources != nil && bm.Resources.ReadConcurrency > 0 {
+		options += fmt.Sprintf(" --read-concurrency=%d", bm.Resources.ReadConcurrency)
+	}
+	if bm.DryRun {
+		options += " --dry-run -v"
+	}
+
 	cmd := createBashCommand(
 		"backup",
 		options,
@@ -131,11 +151,19 @@ func (bm *BackupManager) StartBackup() {
 	res, _ := bm.ExecuteRestic(cmd)
 	result.Output = res.Output
 	result.Status = Success
+	if len(tagWarnings) > 0 {
+		result.Output += "\n" + strings.Join(tagWarnings, "\n") + "\n"
+	}
 
-	if snapshotId := Utils.ResticSnapshotReg.FindStringSubmatch(res.Output); len(snapshotId) == 0 {
+	// No snapshot is saved in dry-run
+	snapshotId := Utils.ResticSnapshotReg.FindStringSubmatch(res.Output)
+	if len(snapshotId) == 0 && !bm.DryRun {
 		result.Status = Failed
 	}
-	if res.ExitCode != 0 {
+	if res.ExitCode == resticIncompleteSnapshot && len(snapshotId) > 0 {
+		result.Status = Warning
+		result.Output += "\nThe snapshot is incomplete, some files couldn't be read\n"
+	} else if res.ExitCode != 0 {
 		result.Status = Failed
 	}
 	endTime := time.Now()
@@ -144,39 +172,107 @@ func (bm *BackupManager) StartBackup() {
 	bm.LastResult = &result
 }
 
-func (bm *BackupManager) Cleanup() {
+// Forget applies the retention policy, the data of the removed snapshots is
+// only deleted by Prune.
+func (bm *BackupManager) Forget() {
 	result := BackupStepResult{
-		Name:      "Cleanup Repository",
-		ShortName: "Cleanup",
+		Name:      "Forget Snapshots",
+		ShortName: "Forget",
 	}
-	Utils.GetLogger().Info(result.Name)
-	if !isLastResultSuccess(bm.LastResult) {
+	bm.logStep(&result)
+	if !bm.isLastResultSuccess() {
 		return
 	}
+	repositoryState := bm.State.Repository(bm.repositoryUrl(bm.Config.Repository))
 	startTime := time.Now()
+	cadence := bm.Config.BackupConfig.Forget.Cadence
+	if !Utils.IsDue(cadence, repositoryState.LastForget, startTime) {
+		bm.log().Info("Forget not due (", cadence, "), last forget on ", repositoryState.LastForget.Format("2006-01-02 15:04:05"))
+		return
+	}
 
-	var options string
-	if len(bm.Config.BackupConfig.ResticOptions) > 0 {
-		options += strings.Join(bm.Config.BackupConfig.ResticOptions, " ")
-	} else {
-		options += strings.Join(Utils.DefaultResticOptions, " ")
+	policy := bm.Config.BackupConfig.ResticOptions
+	if len(policy) == 0 {
+		policy = append([]string{}, Utils.DefaultResticOptions...)
 	}
-	options += fmt.Sprintf(" --tag=%s", bm.Config.BackupConfig.Information.ServerName)
 
-	cmd := createBashCommand(
-		"forget",
-		options,
-		"--prune",
-		"-c",
-	)
+	result.Status = Success
+	for _, options := range bm.forgetOptions(policy) {
+		if bm.DryRun {
+			options = append(options, "--dry-run")
+		}
+		res, _ := bm.ExecuteRestic(createBashCommand("forget", strings.Join(options, " "), "-c"))
+		result.Output += res.Output
+		if res.ExitCode != 0 {
+			result.Status = Failed
+		}
+	}
+	stats := &Utils.ResticStats{}
+	parseForgetStats(result.Output, stats)
+	result.Output += fmt.Sprintf("\nSnapshots kept: %d, removed: %d\n", stats.KeptSnapshots, stats.RemovedSnapshots)
+	if result.Status == Success && !bm.DryRun {
+		repositoryState.LastForget = startTime
+		bm.saveState()
+	}
+	endTime := time.Now()
+	result.Duration = endTime.Sub(startTime)
+	bm.StepResults = append(bm.StepResults, result)
+	bm.LastResult = &result
+}
+
+// Prune deletes the data not referenced anymore, it rewrites packs so it can
+// be scheduled less often than Forget.
+func (bm *BackupManager) Prune() {
+	result := BackupStepResult{
+		Name:      "Prune Repository",
+		ShortName: "Prune",
+	}
+	bm.logStep(&result)
+	if !bm.isLastResultSuccess() {
+		return
+	}
+	pruneConfig := bm.Config.BackupConfig.Prune
+	repositoryState := bm.State.Repository(bm.repositoryUrl(bm.Config.Repository))
+	startTime := time.Now()
+	if !Utils.IsDue(pruneConfig.Cadence, repositoryState.LastPrune, startTime) {
+		bm.log().Info("Prune not due (", pruneConfig.Cadence, "), last prune on ", repositoryState.LastPrune.Format("2006-01-02 15:04:05"))
+		return
+	}
+
+	options := make([]string, 0)
+	if pruneConfig.MaxUnused != "" {
+		options = append(options, "--max-unused="+pruneConfig.MaxUnused)
+	}
+	if pruneConfig.MaxRepackSize != "" {
+		options = append(options, "--max-repack-size="+pruneConfig.MaxRepackSize)
+	}
+	if pruneConfig.RepackCacheableOnly {
+		options = append(options, "--repack-cacheable-only")
+	}
+	cmd := createBashCommand(append([]string{"prune"}, options...)...)
 
+	if bm.DryRun {
+		cmd, envs := bm.resticCommand(cmd)
+		bm.dryRunResult(&result, cmd, envs)
+		return
+	}
 	res, _ := bm.ExecuteRestic(cmd)
 	result.Status = Success
 	result.Output = res.Output
+	stats := &Utils.ResticStats{}
+	parsePruneStats(res.Output, stats)
+	result.Output += fmt.Sprintf("\nFreed: %s (%d blobs), repacked: %s, remaining: %s\n",
+		Utils.HumanBytes(stats.PrunedBytes), stats.PrunedBlobs,
+		Utils.HumanBytes(stats.RepackedBytes), Utils.HumanBytes(stats.RemainingBytes),
+	)
 
 	if res.ExitCode != 0 {
 		result.Status = Failed
 	}
+	if result.Status == Success {
+		repositoryState.LastPrune = startTime
+		bm.saveState()
+	}
 	endTime := time.Now()
 	result.Duration = endTime.Sub(startTime)
 	bm.StepResults = append(bm.StepResults, result)
@@ -188,12 +284,35 @@ func (bm *BackupManager) CheckRepoIntegrity() {
 		Name:      "Check Repository Integrity",
 		ShortName: "CheckRepoIntegrity",
 	}
-	Utils.GetLogger().Info(result.Name)
-	if !isLastResultSuccess(bm.LastResult) {
+	bm.logStep(&result)
+	if !bm.isLastResultSuccess() {
 		return
 	}
+	checkConfig := bm.Config.BackupConfig.Check
+	repositoryState := bm.State.Repository(bm.repositoryUrl(bm.Config.Repository))
 	startTime := time.Now()
-	res, _ := bm.ExecuteRestic("check")
+	if !Utils.IsDue(checkConfig.Cadence, repositoryState.LastCheck, startTime) {
+		bm.log().Info("Integrity check not due (", checkConfig.Cadence, "), last check on ", repositoryState.LastCheck.Format("2006-01-02 15:04:05"))
+		return
+	}
+
+	// Rotating slices read the whole repository data over a cycle of read_data_slices checks
+	var options string
+	var slice int
+	if checkConfig.ReadDataSlices > 0 {
+		slice = repositoryState.LastCheckSlice%checkConfig.ReadDataSlices + 1
+		options = fmt.Sprintf("--read-data-subset=%d/%d", slice, checkConfig.ReadDataSlices)
+	} else if checkConfig.ReadDataSubset != "" {
+		options = "--read-data-subset=" + checkConfig.ReadDataSubset
+	}
+	cmd := createBashCommand("check", options)
+
+	if bm.DryRun {
+		cmd, envs := bm.resticCommand(cmd)
+		bm.dryRunResult(&result, cmd, envs)
+		return
+	}
+	res, _ := bm.ExecuteRestic(cmd)
 	result.Output = res.Output
 	result.Status = Success
 
@@ -204,83 +323,112 @@ func (bm *BackupManager) CheckRepoIntegrity() {
 		result.Status = Success
 	}
 
+	if result.Status == Success {
+		repositoryState.LastCheck = startTime
+		if slice > 0 {
+			repositoryState.LastCheckSlice = slice
+		}
+		bm.saveState()
+	}
+
 	endTime := time.Now()
 	result.Duration = endTime.Sub(startTime)
 	bm.StepResults = append(bm.StepResults, result)
 	bm.LastResult = &result
 }
 
+// Run executes the steps of the job, the steps following a failure are skipped.
+// The commands are killed when the context is done.
+func (bm *BackupManager) Run(ctx context.Context) BackupStatus {
+	bm.ctx = ctx
+	bm.removeOldOutputs()
+	bm.RunHooks(PreBackupHooks)
+	bm.OpenRepo()
+	bm.StartBackup()
+	bm.BackupSources()
+	bm.DiffSnapshots()
+	bm.Forget()
+	bm.Prune()
+	bm.CheckRepoIntegrity()
+	bm.RepositoryStats(false)
+	bm.CopySnapshots()
+	bm.RestoreDrill(false)
+	bm.RunHooks(PostBackupHooks)
+	bm.RunFinalHooks()
+	status, _ := bm.GetResults()
+	bm.RecordHistory()
+	return status
+}
+
 func (bm *BackupManager) GetResults() (BackupStatus, *[]BackupStepResult) {
+	bm.step = ""
 	finalStatus := getFinalStatus(bm.StepResults)
 	if finalStatus == Success {
-		Utils.GetLogger().Info("Backup finished successfully !")
+		bm.log().Info("Backup finished successfully !")
+	} else if finalStatus == Warning {
+		bm.log().Warning("Backup finished with warnings !")
 	} else {
-		Utils.GetLogger().Warning("Backup failed !")
+		bm.log().Warning("Backup failed !")
 	}
 	return finalStatus, nil
 }
 
-func (bm *BackupManager) GetMetrics() *[]string {
+func (bm *BackupManager) GetResticStats() *Utils.ResticStats {
 	resticStats := &Utils.ResticStats{}
-	defaultLabels := &Utils.PrometheusLabels{
-		"repository": bm.Config.Repository,
-		"client":     bm.Config.BackupConfig.Information.ClientName,
-		"name":       bm.Config.BackupConfig.Information.ServerName,
-	}
 	for _, res := range bm.StepResults {
-		if strings.ToLower(res.ShortName) == "startbackup" {
+		if strings.HasPrefix(strings.ToLower(res.ShortName), "startbackup") {
+			if snapshotId := Utils.ResticSnapshotReg.FindStringSubmatch(res.Output); len(snapshotId) == 2 && resticStats.SnapshotId == "" {
+				resticStats.SnapshotId = snapshotId[1]
+			}
 			if filesStats := Utils.ResticFileStatsReg.FindStringSubmatch(res.Output); len(filesStats) == 4 {
 				if tmp, err := strconv.Atoi(filesStats[1]); err == nil {
-					resticStats.FilesNew = tmp
+					resticStats.FilesNew += tmp
 				}
 				if tmp, err := strconv.Atoi(filesStats[2]); err == nil {
-					resticStats.FilesChanged = tmp
+					resticStats.FilesChanged += tmp
 				}
 				if tmp, err := strconv.Atoi(filesStats[3]); err == nil {
-					resticStats.FilesUnmodified = tmp
+					resticStats.FilesUnmodified += tmp
 				}
 			}
 			if dirStats := Utils.ResticDirStatsReg.FindStringSubmatch(res.Output); len(dirStats) == 4 {
 				if tmp, err := strconv.Atoi(dirStats[1]); err == nil {
-					resticStats.DirsNew = tmp
+					resticStats.DirsNew += tmp
 				}
 				if tmp, err := strconv.Atoi(dirStats[2]); err == nil {
-					resticStats.DirsChanged = tmp
+					resticStats.DirsChanged += tmp
 				}
 				if tmp, err := strconv.Atoi(dirStats[3]); err == nil {
-					resticStats.DirsUnmodified = tmp
+					resticStats.DirsUnmodified += tmp
 				}
 			}
 			if addedStats := Utils.ResticAddedBytesReg.FindStringSubmatch(res.Output); len(addedStats) == 3 {
-				if tmp, err := strconv.ParseFloat(addedStats[1], 64); err == nil {
-					tmp *= 1000
-					resticStats.BytesProcessed = Utils.ConvertUnitRate(int(tmp), addedStats[2])
-				}
+				resticStats.BytesAdded += Utils.ParseSize(addedStats[1], addedStats[2])
 			}
 
 			if processedStats := Utils.ResticProcessedReg.FindStringSubmatch(res.Output); len(processedStats) == 4 {
 				if tmp, err := strconv.Atoi(processedStats[1]); err == nil {
-					resticStats.FilesProcessed = tmp
-				}
-				if tmp, err := strconv.ParseFloat(processedStats[2], 64); err == nil {
-					tmp *= 1000
-					resticStats.BytesProcessed = Utils.ConvertUnitRate(int(tmp), processedStats[3])
-				}
-			}
-		} else if strings.ToLower(res.ShortName) == "cleanup" {
-			if keepSnapshots := Utils.ResticKeptSnapsReg.FindStringSubmatch(res.Output); len(keepSnapshots) == 2 {
-				if tmp, err := strconv.Atoi(keepSnapshots[1]); err == nil {
-					resticStats.KeptSnapshots = tmp
-				}
-			}
-			if removeSnapshots := Utils.ResticRemoveSnapsReg.FindStringSubmatch(res.Output); len(removeSnapshots) == 2 {
-				if tmp, err := strconv.Atoi(removeSnapshots[1]); err == nil {
-					resticStats.RemovedSnapshots = tmp
+					resticStats.FilesProcessed += tmp
 				}
+				resticStats.BytesProcessed += Utils.ParseSize(processedStats[2], processedStats[3])
 			}
+		} else if strings.ToLower(res.ShortName) == "prune" {
+			parsePruneStats(res.Output, resticStats)
+		} else if strings.ToLower(res.ShortName) == "forget" {
+			parseForgetStats(res.Output, resticStats)
 		}
 
 	}
+	return resticStats
+}
+
+func (bm *BackupManager) GetMetrics() *[]string {
+	resticStats := bm.GetResticStats()
+	defaultLabels := &Utils.PrometheusLabels{
+		"repository": bm.Config.Repository,
+		"client":     bm.Config.BackupConfig.Information.ClientName,
+		"name":       bm.Config.BackupConfig.Information.ServerName,
+	}
 	metrics := make([]string, 0)
 	metrics = append(metrics,
 		Utils.CreatePrometheusMetric("files_stats", &[]Utils.PrometheusLabels{
@@ -350,9 +498,66 @@ func (bm *BackupManager) GetMetrics() *[]string {
 				resticStats.RemovedSnapshots,
 			}),
 	)
+	if bm.hasStep("prune") {
+		metrics = append(metrics,
+			Utils.CreatePrometheusMetric("prune_freed_bytes",
+				&[]Utils.PrometheusLabels{
+					Utils.MergeMap(nil, *defaultLabels),
+				},
+				[]int{
+					resticStats.PrunedBytes,
+				}),
+			Utils.CreatePrometheusMetric("prune_freed_blobs",
+				&[]Utils.PrometheusLabels{
+					Utils.MergeMap(nil, *defaultLabels),
+				},
+				[]int{
+					resticStats.PrunedBlobs,
+				}),
+			Utils.CreatePrometheusMetric("prune_repacked_bytes",
+				&[]Utils.PrometheusLabels{
+					Utils.MergeMap(nil, *defaultLabels),
+				},
+				[]int{
+					resticStats.RepackedBytes,
+				}),
+			Utils.CreatePrometheusMetric("prune_remaining_bytes",
+				&[]Utils.PrometheusLabels{
+					Utils.MergeMap(nil, *defaultLabels),
+				},
+				[]int{
+					resticStats.RemainingBytes,
+				}),
+		)
+	}
+	metrics = append(metrics, bm.getCheckMetrics(defaultLabels)...)
+	metrics = append(metrics, bm.getCopyMetrics(defaultLabels)...)
+	metrics = append(metrics, bm.getDiffMetrics(defaultLabels)...)
+	metrics = append(metrics, bm.getDrillMetrics(defaultLabels)...)
+	metrics = append(metrics, bm.getStatsMetrics(defaultLabels)...)
+
+	stepLabels := make([]Utils.PrometheusLabels, 0)
+	stepStatus := make([]int, 0)
+	stepDuration := make([]int, 0)
+	for _, res := range bm.StepResults {
+		stepLabels = append(stepLabels, Utils.MergeMap(Utils.PrometheusLabels{
+			"step": res.ShortName,
+		}, *defaultLabels))
+		status := 0
+		if res.Status == Success {
+			status = 1
+		}
+		stepStatus = append(stepStatus, status)
+		stepDuration = append(stepDuration, int(res.Duration.Seconds()))
+	}
+	metrics = append(metrics,
+		Utils.CreatePrometheusMetric("step_status", &stepLabels, stepStatus),
+		Utils.CreatePrometheusMetric("step_duration_seconds", &stepLabels, stepDuration),
+	)
+
 	finalStatus := getFinalStatus(bm.StepResults)
 	metricStatus := 0
-	if finalStatus == Success {
+	if finalStatus != Failed {
 		metricStatus = 1
 	}
 	metrics = append(metrics,
@@ -379,8 +584,17 @@ func (bm *BackupManager) MakeEmailBody() string {
 		bm.Config.Repository,
 	)
 
-	body := fmt.Sprintf("Subject: [%s] Backup '%s' - %s\n\n",
-		strings.Title(getFinalStatus(bm.StepResults).String()),
+	status := strings.Title(getFinalStatus(bm.StepResults).String())
+	if bm.DryRun {
+		status = "Dry-run " + status
+	}
+	title := bm.ReportTitle
+	if title == "" {
+		title = "Backup"
+	}
+	body := fmt.Sprintf("Subject: [%s] %s '%s' - %s\n\n",
+		status,
+		title,
 		backupName[:len(backupName)-1],
 		startTime,
 	)
@@ -390,16 +604,24 @@ func (bm *BackupManager) MakeEmailBody() string {
 		body += "# " + res.Name + "\n"
 		body += strings.Repeat("#", titleSize) + "\n"
 		body += res.Output
+		if res.Output != "" && !strings.HasSuffix(res.Output, "\n") {
+			body += "\n"
+		}
 		body += "Duration: "
 		body += Utils.HumanDuration(res.Duration.Seconds()) + "\n\n"
 		totalDuration += res.Duration
 	}
 	body += "Total Duration: "
 	body += Utils.HumanDuration(totalDuration.Seconds()) + "\n"
+	if resources := bm.Resources.String(); resources != "" {
+		body += "Resources: " + resources + "\n"
+	}
 
 	finalStatus := getFinalStatus(bm.StepResults)
 	if finalStatus == Success {
 		body += "Backup finished successfully !"
+	} else if finalStatus == Warning {
+		body += "Backup finished with warnings !"
 	} else {
 		body += "Backup failed !"
 	}
@@ -407,35 +629,208 @@ func (bm *BackupManager) MakeEmailBody() string {
 }
 
 func (bm *BackupManager) ExecuteRestic(command string) (Utils.CommandResult, error) {
-	pathName := createPathName(
-		bm.Config.BackupConfig.Information.ClientName,
-		bm.Config.BackupConfig.Information.ServerName,
-		bm.Config.Repository,
-	)
-	repository := "rclone:" + bm.Config.BackupConfig.Information.RCloneConnectionName + ":" + createPathName(
-		bm.Config.BackupConfig.Information.BucketName,
-		pathName,
-	)
+	cmd, envs := bm.resticCommand(command)
+	return bm.executeResticCommand(cmd, envs)
+}
+
+func (bm *BackupManager) executeResticCommand(cmd string, envs map[string]string) (Utils.CommandResult, error) {
+	if bm.DryRun {
+		bm.printDryRun(cmd, envs)
+	}
+	bm.log().Debug(cmd)
+	result, err := bm.Executor.Execute(cmd, bm.commandOptions(envs))
+	bm.keepOutput(result)
+	if result.Output != "" {
+		bm.log().Debug(result.Output)
+	}
+	return result, err
+}
+
+func (bm *BackupManager) resticCommand(command string) (string, map[string]string) {
+	return bm.resticCommandOn(bm.repositoryUrl(bm.Config.Repository), bm.Config.ResticPassword, command)
+}
+
+func (bm *BackupManager) resticCommandOn(repositoryUrl string, password string, command string) (string, map[string]string) {
+	var options string
+	if compression := bm.Config.BackupConfig.Repository.Compression; compression != "" {
+		options = "--compression=" + compression
+	}
+	envs := make(map[string]string)
+	envs["RESTIC_PASSWORD"] = password
+	options = createBashCommand(options, bm.resticResources(envs))
+	// The limits are computed when each command starts, to follow the time windows
+	if upload, download := bm.bandwidth(repositoryUrl).Limits(time.Now()); upload > 0 || download > 0 {
+		options = createBashCommand(options, bandwidthOptions(upload, download))
+		envs["RCLONE_BWLIMIT"] = rcloneBandwidth(upload) + ":" + rcloneBandwidth(download)
+	}
 
 	cmd := createBashCommand(
 		bm.Config.BackupConfig.Binaries.Restic,
-		"-r "+repository,
+		"-r "+repositoryUrl,
+		options,
 		command,
 	)
-	Utils.GetLogger().Debug(cmd)
-	envs := make(map[string]string)
-	envs["RESTIC_PASSWORD"] = bm.Config.ResticPassword
-	result, err := Utils.ExecuteCommandWithEnv(cmd, envs)
-	if result.Output != "" {
-		Utils.GetLogger().Debug(result.Output)
+	return cmd, envs
+}
+
+// bandwidth returns the limits of the job, or of the copy target for a secondary repository.
+func (bm *BackupManager) bandwidth(repositoryUrl string) *Model.Bandwidth {
+	if bm.Job != nil {
+		for i := range bm.Job.CopyTo {
+			target := &bm.Job.CopyTo[i]
+			if target.Bandwidth != nil && bm.copyTargetUrl(*target) == repositoryUrl {
+				return target.Bandwidth
+			}
+		}
+		if bm.Job.Bandwidth != nil {
+			return bm.Job.Bandwidth
+		}
 	}
-	return result, err
+	return &bm.Config.BackupConfig.Bandwidth
+}
+
+func bandwidthOptions(upload int, download int) string {
+	var options []string
+	if upload > 0 {
+		options = append(options, fmt.Sprintf("--limit-upload=%d", upload))
+	}
+	if download > 0 {
+		options = append(options, fmt.Sprintf("--limit-download=%d", download))
+	}
+	return strings.Join(options, " ")
+}
+
+func rcloneBandwidth(limit int) string {
+	if limit == 0 {
+		return "off"
+	}
+	return fmt.Sprintf("%dK", limit)
+}
+
+func (bm *BackupManager) getCheckMetrics(defaultLabels *Utils.PrometheusLabels) []string {
+	metrics := make([]string, 0)
+	for _, res := range bm.StepResults {
+		if strings.ToLower(res.ShortName) != "checkrepointegrity" {
+			continue
+		}
+		status := 0
+		if res.Status == Success {
+			status = 1
+		}
+		metrics = append(metrics,
+			Utils.CreatePrometheusMetric("check_status",
+				&[]Utils.PrometheusLabels{
+					Utils.MergeMap(nil, *defaultLabels),
+				},
+				[]int{
+					status,
+				}),
+		)
+	}
+
+	repositoryState := bm.State.Repository(bm.repositoryUrl(bm.Config.Repository))
+	if !repositoryState.LastCheck.IsZero() {
+		metrics = append(metrics,
+			Utils.CreatePrometheusMetric("check_last_success_timestamp_seconds",
+				&[]Utils.PrometheusLabels{
+					Utils.MergeMap(nil, *defaultLabels),
+				},
+				[]int{
+					int(repositoryState.LastCheck.Unix()),
+				}),
+		)
+	}
+	if slices := bm.Config.BackupConfig.Check.ReadDataSlices; slices > 0 {
+		metrics = append(metrics,
+			Utils.CreatePrometheusMetric("check_read_data_slice",
+				&[]Utils.PrometheusLabels{
+					Utils.MergeMap(Utils.PrometheusLabels{
+						"slices": strconv.Itoa(slices),
+					}, *defaultLabels),
+				},
+				[]int{
+					repositoryState.LastCheckSlice,
+				}),
+		)
+	}
+	return metrics
+}
+
+func (bm *BackupManager) getCopyMetrics(defaultLabels *Utils.PrometheusLabels) []string {
+	if bm.Job == nil || len(bm.Job.CopyTo) == 0 {
+		return nil
+	}
+	labels := make([]Utils.PrometheusLabels, 0)
+	status := make([]int, 0)
+	copied := make([]int, 0)
+	for _, res := range bm.StepResults {
+		if !strings.HasPrefix(strings.ToLower(res.ShortName), "copy-") {
+			continue
+		}
+		labels = append(labels, Utils.MergeMap(Utils.PrometheusLabels{
+			"target": strings.TrimPrefix(res.ShortName, "Copy-"),
+		}, *defaultLabels))
+		if res.Status == Success {
+			status = append(status, 1)
+		} else {
+			status = append(status, 0)
+		}
+		copied = append(copied, len(Utils.ResticSnapshotReg.FindAllString(res.Output, -1)))
+	}
+	if len(labels) == 0 {
+		return nil
+	}
+	return []string{
+		Utils.CreatePrometheusMetric("copy_status", &labels, status),
+		Utils.CreatePrometheusMetric("copy_snapshots", &labels, copied),
+	}
+}
+
+func (bm *BackupManager) hasStep(shortName string) bool {
+	for _, res := range bm.StepResults {
+		if strings.ToLower(res.ShortName) == shortName {
+			return true
+		}
+	}
+	return false
+}
+
+func (bm *BackupManager) saveState() {
+	err := bm.State.Save()
+	Utils.WarnOnError(bm.log(), err, "Impossible to save the state", nil)
+}
+
+// repositoryUrl returns the rclone location of a repository of this server.
+func (bm *BackupManager) repositoryUrl(repository string) string {
+	return bm.repositoryLocation(
+		bm.Config.BackupConfig.Information.RCloneConnectionName,
+		bm.Config.BackupConfig.Information.BucketName,
+		repository,
+	)
+}
+
+func (bm *BackupManager) repositoryLocation(connection string, bucket string, repository string) string {
+	pathName := createPathName(
+		bm.Config.BackupConfig.Information.ClientName,
+		bm.Config.BackupConfig.Information.ServerName,
+		repository,
+	)
+	return "rclone:" + connection + ":" + createPathName(
+		bucket,
+		pathName,
+	)
 }
 
 /**** Private ****/
 /*****************/
 func createBashCommand(options ...string) string {
-	return strings.Join(options, " ")
+	parts := make([]string, 0, len(options))
+	for _, option := range options {
+		if option != "" {
+			parts = append(parts, option)
+		}
+	}
+	return strings.Join(parts, " ")
 }
 
 func createPathName(paths ...string) string {
@@ -451,9 +846,52 @@ func createPathName(paths ...string) string {
 	return path
 }
 
-func isLastResultSuccess(result *BackupStepResult) bool {
-	if result != nil && result.Status == Failed {
-		Utils.GetLogger().Warning("Error in the step: " + result.Name + ", bypassing current step.")
+// parseForgetStats sums the snapshots of every group and every forget.
+func parseForgetStats(output string, resticStats *Utils.ResticStats) {
+	for _, keepSnapshots := range Utils.ResticKeptSnapsReg.FindAllStringSubmatch(output, -1) {
+		if tmp, err := strconv.Atoi(keepSnapshots[1]); err == nil {
+			resticStats.KeptSnapshots += tmp
+		}
+	}
+	for _, removeSnapshots := range Utils.ResticRemoveSnapsReg.FindAllStringSubmatch(output, -1) {
+		if tmp, err := strconv.Atoi(removeSnapshots[1]); err == nil {
+			resticStats.RemovedSnapshots += tmp
+		}
+	}
+}
+
+func parsePruneStats(output string, resticStats *Utils.ResticStats) {
+	if pruned := Utils.ResticPruneTotalReg.FindStringSubmatch(output); len(pruned) == 4 {
+		if tmp, err := strconv.Atoi(pruned[1]); err == nil {
+			resticStats.PrunedBlobs = tmp
+		}
+		resticStats.PrunedBytes = Utils.ParseSize(pruned[2], pruned[3])
+	}
+	if repacked := Utils.ResticPruneRepackReg.FindStringSubmatch(output); len(repacked) == 4 {
+		resticStats.RepackedBytes = Utils.ParseSize(repacked[2], repacked[3])
+	}
+	if remaining := Utils.ResticPruneRemainingReg.FindStringSubmatch(output); len(remaining) == 4 {
+		resticStats.RemainingBytes = Utils.ParseSize(remaining[2], remaining[3])
+	}
+}
+
+// logStep logs the start of a step, the following lines carry its name.
+func (bm *BackupManager) logStep(result *BackupStepResult) {
+	bm.step = result.ShortName
+	bm.log().Info(result.Name)
+}
+
+// log returns the logger of the manager, with the current step.
+func (bm *BackupManager) log() logrus.FieldLogger {
+	if bm.step == "" {
+		return bm.logger
+	}
+	return bm.logger.WithField("step", bm.step)
+}
+
+func (bm *BackupManager) isLastResultSuccess() bool {
+	if result := bm.LastResult; result != nil && result.Status == Failed {
+		bm.log().Warning("Error in the step: " + result.Name + ", bypassing current step.")
 		return false
 	}
 	return true
@@ -462,9 +900,11 @@ func isLastResultSuccess(result *BackupStepResult) bool {
 func getFinalStatus(results []BackupStepResult) BackupStatus {
 	var finalStatus BackupStatus
 	for _, result := range results {
-		finalStatus = result.Status
 		if result.Status == Failed {
-			break
+			return Failed
+		}
+		if result.Status == Warning {
+			finalStatus = Warning
 		}
 	}
 	return finalStatus
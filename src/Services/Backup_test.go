@@ -0,0 +1,282 @@
+package Services
+
+import (
+	"context"
+	"github.com/sirupsen/logrus"
+	"gobackup/src/Model"
+	"gobackup/src/Utils"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type expectedStep struct {
+	name   string
+	status BackupStatus
+}
+
+// newTestManager returns the manager of a job backing up /data, its commands
+// are answered by the rules.
+func newTestManager(t *testing.T, extraConfig string, rules []Utils.ScriptRule) (*BackupManager, *Utils.ScriptedExecutor) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "script.yml")
+	if err := ioutil.WriteFile(script, []byte("[]\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	content := `information:
+  server_name: web1
+  rclone_connection_name: remote
+  bucket_name: bucket
+binaries:
+  restic: restic
+executor:
+  type: script
+  script: ` + script + `
+state_dir: ` + filepath.Join(dir, "state") + `
+jobs:
+  - name: files
+    repository: Files
+    folders: [/data]
+` + extraConfig
+	filename := filepath.Join(dir, "config.yml")
+	if err := ioutil.WriteFile(filename, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	config := &Model.Config{}
+	if err := config.LoadBackupConfig(filename); err != nil {
+		t.Fatal(err)
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+	bm := NewBackupManager(config, &config.BackupConfig.Jobs[0], logger)
+	executor, err := Utils.NewScriptedExecutor(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bm.Executor = executor
+	return bm, executor
+}
+
+// resticRules answers every restic command successfully, after the rules given.
+func resticRules(rules ...Utils.ScriptRule) []Utils.ScriptRule {
+	return append(rules,
+		Utils.ScriptRule{Match: ` backup `, Stdout: "Files: 3 new, 1 changed, 10 unmodified\nsnapshot 1a2b3c4d saved\n"},
+		Utils.ScriptRule{Match: ` snapshots --json`, Stdout: `[{"id": "1a2b3c4d5e6f", "short_id": "1a2b3c4d", "time": "2024-05-02T01:00:00Z", "hostname": "web1", "paths": ["/data"], "tags": ["web1"]}]`},
+		Utils.ScriptRule{Match: `^restic `},
+	)
+}
+
+func assertSteps(t *testing.T, bm *BackupManager, expected []expectedStep) {
+	t.Helper()
+	steps := make([]expectedStep, 0)
+	for _, result := range bm.StepResults {
+		steps = append(steps, expectedStep{name: result.ShortName, status: result.Status})
+	}
+	if len(steps) != len(expected) {
+		t.Fatalf("steps %v, expected %v", steps, expected)
+	}
+	for i := range expected {
+		if steps[i] != expected[i] {
+			t.Errorf("step %d is %v, expected %v", i, steps[i], expected[i])
+		}
+	}
+}
+
+func assertCalled(t *testing.T, executor *Utils.ScriptedExecutor, command string, called bool) {
+	t.Helper()
+	found := false
+	for _, call := range executor.Calls() {
+		if strings.Contains(call, command) {
+			found = true
+		}
+	}
+	if found != called {
+		t.Errorf("'%s' called: %v, expected %v, calls: %v", command, found, called, executor.Calls())
+	}
+}
+
+func TestRunSuccess(t *testing.T) {
+	bm, executor := newTestManager(t, "", resticRules())
+	if status := bm.Run(context.Background()); status != Success {
+		t.Errorf("status %s, expected success", status)
+	}
+	assertSteps(t, bm, []expectedStep{
+		{"OpenRepo", Success},
+		{"StartBackup", Success},
+		{"Diff", Success},
+		{"Forget", Success},
+		{"Prune", Success},
+		{"CheckRepoIntegrity", Success},
+	})
+	assertCalled(t, executor, "backup  --tag=web1 /data", true)
+	if stats := bm.GetResticStats(); stats.SnapshotId != "1a2b3c4d" || stats.FilesNew != 3 {
+		t.Errorf("unexpected statistics %+v", stats)
+	}
+}
+
+func TestRunFailingBackup(t *testing.T) {
+	bm, executor := newTestManager(t, "", resticRules(
+		Utils.ScriptRule{Match: ` backup `, Stderr: "Fatal: unable to save snapshot\n", ExitCode: 1},
+	))
+	if status := bm.Run(context.Background()); status != Failed {
+		t.Errorf("status %s, expected failed", status)
+	}
+	assertSteps(t, bm, []expectedStep{
+		{"OpenRepo", Success},
+		{"StartBackup", Failed},
+	})
+	assertCalled(t, executor, " forget ", false)
+	if output := bm.StepResults[1].Output; !strings.Contains(output, "unable to save snapshot") {
+		t.Errorf("the output of restic is missing: %s", output)
+	}
+}
+
+func TestRunHookWarning(t *testing.T) {
+	bm, executor := newTestManager(t, `hooks:
+  pre_backup:
+    - name: mount
+      command: mount /data
+  post_backup:
+    - name: umount
+      command: umount /data
+`, resticRules(
+		Utils.ScriptRule{Match: `^mount `, Stderr: "mount: /data: already mounted\n", ExitCode: 32},
+		Utils.ScriptRule{Match: `^umount `},
+	))
+	if status := bm.Run(context.Background()); status != Warning {
+		t.Errorf("status %s, expected warning", status)
+	}
+	assertSteps(t, bm, []expectedStep{
+		{"Hook-pre_backup-mount", Warning},
+		{"OpenRepo", Success},
+		{"StartBackup", Success},
+		{"Diff", Success},
+		{"Forget", Success},
+		{"Prune", Success},
+		{"CheckRepoIntegrity", Success},
+		{"Hook-post_backup-umount", Success},
+	})
+	assertCalled(t, executor, "umount /data", true)
+}
+
+func TestRunAbortingHook(t *testing.T) {
+	bm, executor := newTestManager(t, `hooks:
+  pre_backup:
+    - name: mount
+      command: mount /data
+      abort_on_error: true
+`, resticRules(
+		Utils.ScriptRule{Match: `^mount `, ExitCode: 32},
+	))
+	if status := bm.Run(context.Background()); status != Failed {
+		t.Errorf("status %s, expected failed", status)
+	}
+	assertSteps(t, bm, []expectedStep{
+		{"Hook-pre_backup-mount", Failed},
+	})
+	assertCalled(t, executor, "restic ", false)
+}
+
+func TestRunAutoInit(t *testing.T) {
+	missing := Utils.ScriptRule{Match: ` cat config$`, Stderr: "Fatal: repository does not exist\n", ExitCode: 10}
+	bm, executor := newTestManager(t, "repository:\n  auto_init: true\n", resticRules(missing))
+	if status := bm.Run(context.Background()); status != Success {
+		t.Errorf("status %s, expected success", status)
+	}
+	assertSteps(t, bm, []expectedStep{
+		{"InitRepo", Success},
+		{"StartBackup", Success},
+		{"Diff", Success},
+		{"Forget", Success},
+		{"Prune", Success},
+		{"CheckRepoIntegrity", Success},
+	})
+	assertCalled(t, executor, "/web1/Files/ init", true)
+}
+
+func TestRunMissingRepository(t *testing.T) {
+	missing := Utils.ScriptRule{Match: ` cat config$`, Stderr: "Fatal: repository does not exist\n", ExitCode: 10}
+	bm, executor := newTestManager(t, "", resticRules(missing))
+	if status := bm.Run(context.Background()); status != Failed {
+		t.Errorf("status %s, expected failed", status)
+	}
+	assertSteps(t, bm, []expectedStep{
+		{"OpenRepo", Failed},
+	})
+	assertCalled(t, executor, " init", false)
+	if output := bm.StepResults[0].Output; !strings.Contains(output, "repository.auto_init") {
+		t.Errorf("the output doesn't tell how to initialize the repository: %s", output)
+	}
+}
+
+func TestCheckRotatingSlices(t *testing.T) {
+	bm, executor := newTestManager(t, "check:\n  read_data_slices: 3\n", resticRules(
+		Utils.ScriptRule{Match: ` check --read-data-subset=2/3$`, Stderr: "Fatal: pack 1a2b3c4d: invalid data\n", ExitCode: 1},
+	))
+	// A failed check is retried on the same slice
+	for _, slice := range []string{"1/3", "2/3", "2/3"} {
+		bm.LastResult = nil
+		bm.CheckRepoIntegrity()
+		calls := executor.Calls()
+		if last := calls[len(calls)-1]; !strings.HasSuffix(last, " check --read-data-subset="+slice) {
+			t.Fatalf("'%s', expected the slice %s", last, slice)
+		}
+	}
+
+	// The slices start over after the last one, the state keeps the last checked slice
+	bm, executor = newTestManager(t, "check:\n  read_data_slices: 3\n", resticRules())
+	for _, slice := range []string{"1/3", "2/3", "3/3", "1/3"} {
+		bm.LastResult = nil
+		bm.CheckRepoIntegrity()
+		calls := executor.Calls()
+		if last := calls[len(calls)-1]; !strings.HasSuffix(last, " check --read-data-subset="+slice) {
+			t.Fatalf("'%s', expected the slice %s", last, slice)
+		}
+	}
+	state, err := LoadState(bm.Config.BackupConfig.StateDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved := state.Repository(bm.repositoryUrl("Files")).LastCheckSlice; saved != 1 {
+		t.Errorf("last slice %d saved, expected 1", saved)
+	}
+}
+
+func TestCheckCadence(t *testing.T) {
+	bm, executor := newTestManager(t, "check:\n  cadence: daily\n", resticRules())
+	bm.CheckRepoIntegrity()
+	bm.LastResult = nil
+	bm.CheckRepoIntegrity()
+	checks := 0
+	for _, call := range executor.Calls() {
+		if strings.HasSuffix(call, " check") {
+			checks++
+		}
+	}
+	if checks != 1 {
+		t.Errorf("%d checks, expected 1 per day", checks)
+	}
+}
+
+func TestRunDryRun(t *testing.T) {
+	bm, executor := newTestManager(t, `hooks:
+  pre_backup:
+    - name: mount
+      command: mount /data
+`, resticRules())
+	bm.DryRun = true
+	if status := bm.Run(context.Background()); status != Success {
+		t.Errorf("status %s, expected success", status)
+	}
+	// Only restic backup and forget run, with --dry-run, the other commands are printed
+	for _, call := range executor.Calls() {
+		if !strings.Contains(call, " cat config") && !strings.Contains(call, " --dry-run") {
+			t.Errorf("'%s' executed in dry-run", call)
+		}
+	}
+	assertCalled(t, executor, " prune", false)
+	assertCalled(t, executor, " check", false)
+	assertCalled(t, executor, "mount /data", false)
+}
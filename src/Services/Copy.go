@@ -0,0 +1,163 @@
+package Services
+
+import (
+	"fmt"
+	"gobackup/src/Model"
+	"gobackup/src/Utils"
+	"os"
+	"strings"
+	"time"
+)
+
+// CopySnapshots replicates the snapshots of the server into every secondary
+// repository of the job, then applies the retention policy on them. restic
+// copy skips the snapshots already present, so a failed copy is caught up by
+// the next run.
+func (bm *BackupManager) CopySnapshots() {
+	if bm.Job == nil || len(bm.Job.CopyTo) == 0 {
+		return
+	}
+	if !bm.isLastResultSuccess() {
+		return
+	}
+	for _, target := range bm.Job.CopyTo {
+		if bm.copyTo(target) {
+			bm.forgetCopy(target)
+		}
+	}
+}
+
+func (bm *BackupManager) copyTo(target Model.CopyTarget) bool {
+	result := BackupStepResult{
+		Name:      "Copy to " + target.Name,
+		ShortName: "Copy-" + target.Name,
+	}
+	bm.logStep(&result)
+	startTime := time.Now()
+
+	password, err := bm.copyTargetPassword(target)
+	if err != nil {
+		result.Output = err.Error()
+		result.Status = Failed
+		bm.appendResult(&result, startTime)
+		return false
+	}
+	cmd, envs := bm.resticCommandOn(bm.copyTargetUrl(target), password, createBashCommand(
+		"copy",
+		"--from-repo="+bm.repositoryUrl(bm.Config.Repository),
+		fmt.Sprintf("--tag=%s", bm.Config.BackupConfig.Information.ServerName),
+	))
+	envs["RESTIC_FROM_PASSWORD"] = bm.Config.ResticPassword
+	if bm.DryRun {
+		bm.dryRunResult(&result, cmd, envs)
+		return true
+	}
+
+	res, _ := bm.executeResticCommand(cmd, envs)
+	result.Output = res.Output
+	result.Status = Success
+	if res.ExitCode != 0 {
+		result.Status = Failed
+	}
+	result.Output += fmt.Sprintf("\nSnapshots copied: %d\n", len(Utils.ResticSnapshotReg.FindAllString(res.Output, -1)))
+	bm.appendResult(&result, startTime)
+	return result.Status == Success
+}
+
+// forgetCopy applies the retention policy on the secondary repository, and
+// prunes it following the prune cadence.
+func (bm *BackupManager) forgetCopy(target Model.CopyTarget) {
+	result := BackupStepResult{
+		Name:      "Forget Snapshots on " + target.Name,
+		ShortName: "Forget-" + target.Name,
+	}
+	bm.logStep(&result)
+	startTime := time.Now()
+	url := bm.copyTargetUrl(target)
+	repositoryState := bm.State.Repository(url)
+	pruneConfig := bm.Config.BackupConfig.Prune
+
+	policy := target.ResticOptions
+	if len(policy) == 0 {
+		policy = bm.Config.BackupConfig.ResticOptions
+	}
+	if len(policy) == 0 {
+		policy = append([]string{}, Utils.DefaultResticOptions...)
+	}
+	commands := bm.forgetOptions(policy)
+	// The data of every forget is pruned by the last one
+	prune := Utils.IsDue(pruneConfig.Cadence, repositoryState.LastPrune, startTime)
+	if prune {
+		last := len(commands) - 1
+		commands[last] = append(commands[last], "--prune")
+		if pruneConfig.MaxUnused != "" {
+			commands[last] = append(commands[last], "--max-unused="+pruneConfig.MaxUnused)
+		}
+		if pruneConfig.MaxRepackSize != "" {
+			commands[last] = append(commands[last], "--max-repack-size="+pruneConfig.MaxRepackSize)
+		}
+		if pruneConfig.RepackCacheableOnly {
+			commands[last] = append(commands[last], "--repack-cacheable-only")
+		}
+	}
+
+	password, _ := bm.copyTargetPassword(target)
+	result.Status = Success
+	for _, options := range commands {
+		if bm.DryRun {
+			options = append(options, "--dry-run")
+		}
+		cmd, envs := bm.resticCommandOn(url, password, createBashCommand("forget", strings.Join(options, " "), "-c"))
+		res, _ := bm.executeResticCommand(cmd, envs)
+		result.Output += res.Output
+		if res.ExitCode != 0 {
+			result.Status = Failed
+		}
+	}
+
+	stats := &Utils.ResticStats{}
+	parseForgetStats(result.Output, stats)
+	parsePruneStats(result.Output, stats)
+	result.Output += fmt.Sprintf("\nSnapshots kept: %d, removed: %d\n", stats.KeptSnapshots, stats.RemovedSnapshots)
+	if prune {
+		result.Output += fmt.Sprintf("Freed: %s (%d blobs)\n", Utils.HumanBytes(stats.PrunedBytes), stats.PrunedBlobs)
+	}
+	if result.Status == Success && !bm.DryRun && prune {
+		repositoryState.LastPrune = startTime
+		bm.saveState()
+	}
+	bm.appendResult(&result, startTime)
+}
+
+func (bm *BackupManager) copyTargetUrl(target Model.CopyTarget) string {
+	connection := target.RCloneConnectionName
+	if connection == "" {
+		connection = bm.Config.BackupConfig.Information.RCloneConnectionName
+	}
+	bucket := target.BucketName
+	if bucket == "" {
+		bucket = bm.Config.BackupConfig.Information.BucketName
+	}
+	repository := target.Repository
+	if repository == "" {
+		repository = bm.Config.Repository
+	}
+	return bm.repositoryLocation(connection, bucket, repository)
+}
+
+func (bm *BackupManager) copyTargetPassword(target Model.CopyTarget) (string, error) {
+	if target.PasswordEnv == "" {
+		return bm.Config.ResticPassword, nil
+	}
+	if password, ok := os.LookupEnv(target.PasswordEnv); ok && password != "" {
+		return password, nil
+	}
+	return "", fmt.Errorf("the password of '%s' must be set in the environment variable %s", target.Name, target.PasswordEnv)
+}
+
+// appendResult records a step which is not followed by the next steps,
+// a failing copy must not skip the copies to the other repositories.
+func (bm *BackupManager) appendResult(result *BackupStepResult, startTime time.Time) {
+	result.Duration = time.Now().Sub(startTime)
+	bm.StepResults = append(bm.StepResults, *result)
+}
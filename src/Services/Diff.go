@@ -0,0 +1,256 @@
+package Services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"gobackup/src/Utils"
+	"sort"
+	"strings"
+	"time"
+)
+
+type SnapshotDiff struct {
+	Snapshot     string
+	Previous     string
+	Added        int
+	Removed      int
+	Modified     int
+	Directories  []DirectoryChanges
+	LargestFiles []resticNode
+}
+
+type DirectoryChanges struct {
+	Path     string
+	Added    int
+	Removed  int
+	Modified int
+}
+
+func (d DirectoryChanges) total() int {
+	return d.Added + d.Removed + d.Modified
+}
+
+type resticChange struct {
+	MessageType string `json:"message_type"`
+	Path        string `json:"path"`
+	Modifier    string `json:"modifier"`
+}
+
+// DiffSnapshots compares each snapshot saved by this run with the previous
+// snapshot of the same paths. A failing diff is only a warning.
+func (bm *BackupManager) DiffSnapshots() {
+	if bm.Config.BackupConfig.Diff.Disabled || bm.DryRun {
+		return
+	}
+	backups := make([]BackupStepResult, 0)
+	for _, res := range bm.StepResults {
+		if strings.HasPrefix(strings.ToLower(res.ShortName), "startbackup") && res.Status == Success {
+			backups = append(backups, res)
+		}
+	}
+	if len(backups) == 0 {
+		return
+	}
+
+	snapshots, err := bm.listSnapshots(fmt.Sprintf("--tag=%s", bm.Config.BackupConfig.Information.ServerName))
+	for _, backup := range backups {
+		result := BackupStepResult{
+			Name:      "Snapshot Diff",
+			ShortName: strings.Replace(backup.ShortName, "StartBackup", "Diff", 1),
+		}
+		bm.logStep(&result)
+		startTime := time.Now()
+		result.Status = Success
+		diff, diffErr := bm.diffSnapshot(snapshots, backup.Output)
+		if err != nil {
+			diffErr = err
+		}
+		if diffErr != nil {
+			result.Status = Warning
+			result.Output = diffErr.Error() + "\n"
+		} else {
+			result.Output = diff.summary(bm.Config.BackupConfig.Diff.Top)
+			if diff.Previous != "" {
+				bm.log().Info("Snapshot ", diff.Snapshot, " compared to ", diff.Previous)
+				bm.Diffs = append(bm.Diffs, diff)
+			}
+		}
+		endTime := time.Now()
+		result.Duration = endTime.Sub(startTime)
+		bm.StepResults = append(bm.StepResults, result)
+	}
+}
+
+func (bm *BackupManager) diffSnapshot(snapshots []Snapshot, backupOutput string) (*SnapshotDiff, error) {
+	match := Utils.ResticSnapshotReg.FindStringSubmatch(backupOutput)
+	if len(match) < 2 {
+		return nil, fmt.Errorf("no snapshot saved")
+	}
+	current, ok := findSnapshot(snapshots, match[1])
+	if !ok {
+		return nil, fmt.Errorf("snapshot %s not found", match[1])
+	}
+	diff := &SnapshotDiff{Snapshot: current.ShortId}
+	previous, ok := previousSnapshot(snapshots, current)
+	if !ok {
+		return diff, nil
+	}
+	diff.Previous = previous.ShortId
+
+	cmd, envs := bm.resticCommand(createBashCommand("diff", "--json", previous.Id, current.Id))
+	var stdout bytes.Buffer
+	res, err := bm.Executor.ExecuteWithStdout(cmd, bm.commandOptions(envs), &stdout)
+	if err != nil {
+		return nil, fmt.Errorf("restic diff failed: %s %s", err, res.Output)
+	}
+
+	directories := make(map[string]*DirectoryChanges)
+	added := make(map[string]bool)
+	scanner := bufio.NewScanner(&stdout)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		var change resticChange
+		if err := json.Unmarshal(scanner.Bytes(), &change); err != nil || change.MessageType != "change" {
+			continue
+		}
+		// Directories are reported with a trailing slash, only files are counted
+		if strings.HasSuffix(change.Path, "/") {
+			continue
+		}
+		directory := topLevelDirectory(current.Paths, change.Path)
+		if directories[directory] == nil {
+			directories[directory] = &DirectoryChanges{Path: directory}
+		}
+		switch change.Modifier {
+		case "+":
+			diff.Added++
+			directories[directory].Added++
+			added[change.Path] = true
+		case "-":
+			diff.Removed++
+			directories[directory].Removed++
+		default:
+			diff.Modified++
+			directories[directory].Modified++
+		}
+	}
+	for _, directory := range directories {
+		diff.Directories = append(diff.Directories, *directory)
+	}
+	sort.Slice(diff.Directories, func(i, j int) bool {
+		if diff.Directories[i].total() != diff.Directories[j].total() {
+			return diff.Directories[i].total() > diff.Directories[j].total()
+		}
+		return diff.Directories[i].Path < diff.Directories[j].Path
+	})
+
+	if len(added) > 0 {
+		diff.LargestFiles, err = bm.largestFiles(current.Id, added, bm.Config.BackupConfig.Diff.Top)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return diff, nil
+}
+
+// largestFiles returns the biggest files of the snapshot among the given paths.
+func (bm *BackupManager) largestFiles(snapshotId string, paths map[string]bool, top int) ([]resticNode, error) {
+	cmd, envs := bm.resticCommand(createBashCommand("ls", "--json", snapshotId))
+	var stdout bytes.Buffer
+	res, err := bm.Executor.ExecuteWithStdout(cmd, bm.commandOptions(envs), &stdout)
+	if err != nil {
+		return nil, fmt.Errorf("can't list the snapshot %s: %s %s", snapshotId, err, res.Output)
+	}
+	files := make([]resticNode, 0)
+	scanner := bufio.NewScanner(&stdout)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		var node resticNode
+		if err := json.Unmarshal(scanner.Bytes(), &node); err != nil {
+			continue
+		}
+		if node.Type == "file" && paths[node.Path] {
+			files = append(files, node)
+		}
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].Size > files[j].Size
+	})
+	if len(files) > top {
+		files = files[:top]
+	}
+	return files, nil
+}
+
+// topLevelDirectory returns the first directory of the path below the backed up folder.
+func topLevelDirectory(roots []string, path string) string {
+	for _, root := range roots {
+		root = strings.TrimSuffix(root, "/")
+		if !strings.HasPrefix(path, root+"/") {
+			continue
+		}
+		relative := strings.TrimPrefix(path, root+"/")
+		if i := strings.Index(relative, "/"); i >= 0 {
+			return root + "/" + relative[:i]
+		}
+		return root
+	}
+	return "/"
+}
+
+func (d *SnapshotDiff) summary(top int) string {
+	if d.Previous == "" {
+		return fmt.Sprintf("Snapshot %s is the first one of these paths, nothing to compare\n", d.Snapshot)
+	}
+	output := fmt.Sprintf("Snapshot %s compared to %s: %d added, %d removed, %d modified\n",
+		d.Snapshot, d.Previous, d.Added, d.Removed, d.Modified)
+	for i, directory := range d.Directories {
+		if i == top {
+			output += fmt.Sprintf("  ... and %d more directories\n", len(d.Directories)-top)
+			break
+		}
+		output += fmt.Sprintf("  %s: %d added, %d removed, %d modified\n",
+			directory.Path, directory.Added, directory.Removed, directory.Modified)
+	}
+	if len(d.LargestFiles) > 0 {
+		output += "Largest new files:\n"
+		for _, file := range d.LargestFiles {
+			output += fmt.Sprintf("  %s (%s)\n", file.Path, Utils.HumanBytes(file.Size))
+		}
+	}
+	return output
+}
+
+// getDiffMetrics exports the changes of the snapshots of the run, summed over
+// its backups. The labels don't change from a run to another, the snapshot
+// ids and the paths are only in the report and the logs.
+func (bm *BackupManager) getDiffMetrics(defaultLabels *Utils.PrometheusLabels) []string {
+	if len(bm.Diffs) == 0 {
+		return nil
+	}
+	changes := make([]int, 3)
+	directories, largest := 0, 0
+	for _, diff := range bm.Diffs {
+		for i, count := range []int{diff.Added, diff.Removed, diff.Modified} {
+			changes[i] += count
+		}
+		directories += len(diff.Directories)
+		for _, file := range diff.LargestFiles {
+			if file.Size > largest {
+				largest = file.Size
+			}
+		}
+	}
+	changeLabels := make([]Utils.PrometheusLabels, 0, len(changes))
+	for _, change := range []string{"added", "removed", "modified"} {
+		changeLabels = append(changeLabels, Utils.MergeMap(Utils.PrometheusLabels{"change": change}, *defaultLabels))
+	}
+	labels := &[]Utils.PrometheusLabels{Utils.MergeMap(Utils.PrometheusLabels{}, *defaultLabels)}
+	return []string{
+		Utils.CreatePrometheusMetric("diff_files", &changeLabels, changes),
+		Utils.CreatePrometheusMetric("diff_changed_directories", labels, []int{directories}),
+		Utils.CreatePrometheusMetric("diff_largest_new_file_bytes", labels, []int{largest}),
+	}
+}
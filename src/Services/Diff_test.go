@@ -0,0 +1,39 @@
+package Services
+
+import (
+	"gobackup/src/Utils"
+	"strings"
+	"testing"
+)
+
+func TestDiffMetrics(t *testing.T) {
+	bm := &BackupManager{Diffs: []*SnapshotDiff{
+		{
+			Snapshot: "1a2b3c4d", Previous: "0f0f0f0f", Added: 2, Removed: 1, Modified: 3,
+			Directories:  []DirectoryChanges{{Path: "/data/a", Added: 2}, {Path: "/data/b", Removed: 1, Modified: 3}},
+			LargestFiles: []resticNode{{Path: "/data/a/big", Size: 2048}, {Path: "/data/a/small", Size: 10}},
+		},
+		{
+			Snapshot: "5e6f7a8b", Previous: "0e0e0e0e", Added: 1,
+			Directories:  []DirectoryChanges{{Path: "/db", Added: 1}},
+			LargestFiles: []resticNode{{Path: "/db/dump.sql", Size: 512}},
+		},
+	}}
+	metrics := strings.Join(bm.getDiffMetrics(&Utils.PrometheusLabels{"repository": "files"}), "")
+	for _, expected := range []string{
+		`change="added"`, "} 3\n",
+		`change="removed"`, "} 1\n",
+		"backup_diff_changed_directories{repository=\"files\"} 3\n",
+		"backup_diff_largest_new_file_bytes{repository=\"files\"} 2048\n",
+	} {
+		if !strings.Contains(metrics, expected) {
+			t.Errorf("'%s' missing in:\n%s", expected, metrics)
+		}
+	}
+	// The labels are the same on every run
+	for _, label := range []string{"snapshot=", "path=", "directory="} {
+		if strings.Contains(metrics, label) {
+			t.Errorf("unexpected label %s in:\n%s", label, metrics)
+		}
+	}
+}
@@ -0,0 +1,326 @@
+package Services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"gobackup/src/Utils"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type DrillResult struct {
+	SnapshotId      string
+	Files           int
+	Bytes           int
+	Mismatches      int
+	RestoreDuration time.Duration
+}
+
+type resticNode struct {
+	StructType string `json:"struct_type"`
+	Id         string `json:"id"`
+	Type       string `json:"type"`
+	Path       string `json:"path"`
+	Size       int    `json:"size"`
+}
+
+// RestoreDrill restores a sample of files from the latest snapshot into a
+// temporary directory, and compares them with the content of the repository.
+// The restore duration is the recovery time metric. force runs the drill
+// whatever the drill cadence.
+func (bm *BackupManager) RestoreDrill(force bool) {
+	result := BackupStepResult{
+		Name:      "Restore Drill",
+		ShortName: "Drill",
+	}
+	bm.logStep(&result)
+	if !bm.isLastResultSuccess() {
+		return
+	}
+	drillConfig := bm.Config.BackupConfig.Drill
+	repositoryState := bm.State.Repository(bm.repositoryUrl(bm.Config.Repository))
+	startTime := time.Now()
+	if !force && !Utils.IsDue(drillConfig.Cadence, repositoryState.LastDrill, startTime) {
+		bm.log().Info("Restore drill not due (", drillConfig.Cadence, "), last drill on ", repositoryState.LastDrill.Format("2006-01-02 15:04:05"))
+		return
+	}
+	// The restored files are compared on this host
+	if _, local := bm.Executor.(*Utils.LocalExecutor); !local {
+		result.Output = "Restore drills are only supported with the local executor\n"
+		result.Status = Warning
+		bm.StepResults = append(bm.StepResults, result)
+		bm.LastResult = &result
+		return
+	}
+	if bm.DryRun {
+		cmd, envs := bm.resticCommand(bm.latestSnapshotCommand("ls", "--json"))
+		bm.dryRunResult(&result, cmd, envs)
+		return
+	}
+
+	drill, output, err := bm.restoreDrill()
+	bm.Drill = drill
+	result.Output = output
+	result.Status = Success
+	if err != nil {
+		result.Output += "\n" + err.Error()
+		result.Status = Failed
+	}
+	if result.Status == Success {
+		repositoryState.LastDrill = startTime
+		bm.saveState()
+	}
+	endTime := time.Now()
+	result.Duration = endTime.Sub(startTime)
+	bm.StepResults = append(bm.StepResults, result)
+	bm.LastResult = &result
+}
+
+func (bm *BackupManager) restoreDrill() (*DrillResult, string, error) {
+	drillConfig := bm.Config.BackupConfig.Drill
+	drill := &DrillResult{}
+	var output string
+
+	snapshotId, sample, err := bm.listLatestSnapshot(drillConfig.Paths, drillConfig.SampleSize)
+	if err != nil {
+		return drill, output, err
+	}
+	drill.SnapshotId = snapshotId
+	output += fmt.Sprintf("Snapshot %s, %d file(s) sampled\n", snapshotId, len(sample))
+
+	targetDir, err := ioutil.TempDir(drillConfig.TargetDir, "gobackup-drill-")
+	if err != nil {
+		return drill, output, err
+	}
+	defer os.RemoveAll(targetDir)
+
+	includes := make([]string, 0, len(sample))
+	for _, file := range sample {
+		includes = append(includes, "--include="+file.Path)
+	}
+	restoreStart := time.Now()
+	res, _ := bm.ExecuteRestic(createBashCommand("restore", snapshotId, "--target="+targetDir, strings.Join(includes, " ")))
+	drill.RestoreDuration = time.Now().Sub(restoreStart)
+	output += fmt.Sprintf("Restored in %s\n", Utils.HumanDuration(drill.RestoreDuration.Seconds()))
+	if res.ExitCode != 0 {
+		return drill, output + res.Output, fmt.Errorf("restore failed with exit code %d", res.ExitCode)
+	}
+
+	for _, file := range sample {
+		restored, err := hashFile(filepath.Join(targetDir, file.Path))
+		if err != nil {
+			drill.Mismatches++
+			output += fmt.Sprintf("- %s: not restored (%s)\n", file.Path, err)
+			continue
+		}
+		expected, err := bm.hashSnapshotFile(snapshotId, file.Path)
+		if err != nil {
+			drill.Mismatches++
+			output += fmt.Sprintf("- %s: can't be read from the repository (%s)\n", file.Path, err)
+			continue
+		}
+		if restored != expected {
+			drill.Mismatches++
+			output += fmt.Sprintf("- %s: content mismatch (%s != %s)\n", file.Path, restored, expected)
+			continue
+		}
+		drill.Files++
+		drill.Bytes += file.Size
+		output += fmt.Sprintf("- %s: ok (%s)\n", file.Path, Utils.HumanBytes(file.Size))
+	}
+	if drill.Mismatches > 0 {
+		return drill, output, fmt.Errorf("%d file(s) differ from the repository", drill.Mismatches)
+	}
+
+	if drillConfig.VerifyCommand != "" {
+		options := bm.commandOptions(map[string]string{
+			"GOBACKUP_DRILL_DIR":         targetDir,
+			"GOBACKUP_DRILL_SNAPSHOT_ID": snapshotId,
+			"GOBACKUP_REPOSITORY":        bm.Config.Repository,
+		})
+		options.Timeout = drillConfig.Timeout
+		options.Shell = true
+		res, err := bm.Executor.Execute(drillConfig.VerifyCommand, options)
+		bm.keepOutput(res)
+		output += "Verification: " + res.Output + "\n"
+		if err != nil {
+			return drill, output, fmt.Errorf("verification command failed: %s", err)
+		}
+	}
+	return drill, output, nil
+}
+
+// listLatestSnapshot returns the id of the latest snapshot of the server and
+// the files to restore. The listing is decoded while restic prints it, only
+// the selected files are kept in memory.
+func (bm *BackupManager) listLatestSnapshot(paths []string, sampleSize int) (string, []resticNode, error) {
+	var snapshotId string
+	sampler := newDrillSampler(paths, sampleSize)
+	res, err := bm.streamNodes(bm.latestSnapshotCommand("ls", "--json"), func(node resticNode) {
+		if node.StructType == "snapshot" && snapshotId == "" {
+			snapshotId = node.Id
+		} else if node.Type == "file" {
+			sampler.add(node)
+		}
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("can't list the latest snapshot: %s %s", err, res.Output)
+	}
+	if snapshotId == "" {
+		return "", nil, fmt.Errorf("no snapshot found for '%s'", bm.Config.BackupConfig.Information.ServerName)
+	}
+	sample, err := sampler.selected()
+	return snapshotId, sample, err
+}
+
+// streamNodes runs the restic command and gives each json line of its output
+// to visit, as it is printed.
+func (bm *BackupManager) streamNodes(command string, visit func(node resticNode)) (Utils.CommandResult, error) {
+	cmd, envs := bm.resticCommand(command)
+	reader, writer := io.Pipe()
+	decoded := make(chan error, 1)
+	go func() {
+		decoder := json.NewDecoder(reader)
+		for {
+			var node resticNode
+			if err := decoder.Decode(&node); err != nil {
+				// The rest of the output is read for the command to finish
+				_, _ = io.Copy(ioutil.Discard, reader)
+				if err == io.EOF {
+					err = nil
+				}
+				decoded <- err
+				return
+			}
+			visit(node)
+		}
+	}()
+	res, err := bm.Executor.ExecuteWithStdout(cmd, bm.commandOptions(envs), writer)
+	_ = writer.Close()
+	if decodeErr := <-decoded; err == nil && decodeErr != nil {
+		err = fmt.Errorf("invalid output: %s", decodeErr)
+	}
+	return res, err
+}
+
+func (bm *BackupManager) latestSnapshotCommand(command string, options ...string) string {
+	return createBashCommand(append([]string{
+		command,
+		fmt.Sprintf("--tag=%s", bm.Config.BackupConfig.Information.ServerName),
+		"latest",
+	}, options...)...)
+}
+
+func (bm *BackupManager) hashSnapshotFile(snapshotId string, path string) (string, error) {
+	cmd, envs := bm.resticCommand(createBashCommand("dump", snapshotId, path))
+	hash := sha256.New()
+	res, err := bm.Executor.ExecuteWithStdout(cmd, bm.commandOptions(envs), hash)
+	if err != nil {
+		return "", fmt.Errorf("%s %s", err, res.Output)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// drillSampler selects the files to restore while the snapshot is listed:
+// the configured paths, or a random sample of the files kept by reservoir
+// sampling. The commands are split on spaces, so files with spaces can't be
+// sampled.
+type drillSampler struct {
+	paths  []string
+	size   int
+	random *rand.Rand
+	found  map[string]resticNode
+	seen   int
+	sample []resticNode
+}
+
+func newDrillSampler(paths []string, size int) *drillSampler {
+	s := &drillSampler{
+		paths:  paths,
+		size:   size,
+		random: rand.New(rand.NewSource(time.Now().UnixNano())),
+		found:  make(map[string]resticNode),
+	}
+	for _, path := range paths {
+		s.found[path] = resticNode{}
+	}
+	return s
+}
+
+func (s *drillSampler) add(file resticNode) {
+	if len(s.paths) > 0 {
+		if previous, ok := s.found[file.Path]; ok && previous.Path == "" {
+			s.found[file.Path] = file
+		}
+		return
+	}
+	if strings.ContainsAny(file.Path, " \t") {
+		return
+	}
+	// Each of the files seen so far has the same chance to be in the sample
+	s.seen++
+	if len(s.sample) < s.size {
+		s.sample = append(s.sample, file)
+	} else if i := s.random.Intn(s.seen); i < s.size {
+		s.sample[i] = file
+	}
+}
+
+// selected returns the configured paths in order, or the sample.
+func (s *drillSampler) selected() ([]resticNode, error) {
+	if len(s.paths) > 0 {
+		selected := make([]resticNode, 0, len(s.paths))
+		for _, path := range s.paths {
+			if s.found[path].Path == "" {
+				return nil, fmt.Errorf("file '%s' not found in the snapshot", path)
+			}
+			selected = append(selected, s.found[path])
+		}
+		return selected, nil
+	}
+	if len(s.sample) == 0 {
+		return nil, fmt.Errorf("no file to restore in the snapshot")
+	}
+	return s.sample, nil
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func (bm *BackupManager) getDrillMetrics(defaultLabels *Utils.PrometheusLabels) []string {
+	if bm.Drill == nil {
+		return nil
+	}
+	status := 0
+	for _, res := range bm.StepResults {
+		if strings.ToLower(res.ShortName) == "drill" && res.Status == Success {
+			status = 1
+		}
+	}
+	// The snapshot id is in the report, a label would make new series on every drill
+	labels := &[]Utils.PrometheusLabels{Utils.MergeMap(Utils.PrometheusLabels{}, *defaultLabels)}
+	return []string{
+		Utils.CreatePrometheusMetric("drill_status", labels, []int{status}),
+		Utils.CreatePrometheusMetric("drill_restore_duration_seconds", labels, []int{int(bm.Drill.RestoreDuration.Seconds())}),
+		Utils.CreatePrometheusMetric("drill_files", labels, []int{bm.Drill.Files}),
+		Utils.CreatePrometheusMetric("drill_bytes", labels, []int{bm.Drill.Bytes}),
+		Utils.CreatePrometheusMetric("drill_mismatches", labels, []int{bm.Drill.Mismatches}),
+	}
+}
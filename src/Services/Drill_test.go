@@ -0,0 +1,103 @@
+package Services
+
+import (
+	"fmt"
+	"gobackup/src/Utils"
+	"strings"
+	"testing"
+)
+
+func TestDrillSampler(t *testing.T) {
+	chosen := make(map[string]int)
+	for run := 0; run < 1000; run++ {
+		sampler := newDrillSampler(nil, 2)
+		for i := 0; i < 10; i++ {
+			sampler.add(resticNode{Type: "file", Path: fmt.Sprintf("/data/file%d", i)})
+			sampler.add(resticNode{Type: "file", Path: fmt.Sprintf("/data/with space%d", i)})
+		}
+		sample, err := sampler.selected()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(sample) != 2 || sample[0].Path == sample[1].Path {
+			t.Fatalf("unexpected sample %v", sample)
+		}
+		for _, file := range sample {
+			chosen[file.Path]++
+		}
+	}
+	// Every file can be sampled, except the ones with spaces
+	if len(chosen) != 10 {
+		t.Errorf("files sampled %v, expected the 10 files without spaces", chosen)
+	}
+
+	if _, err := newDrillSampler(nil, 5).selected(); err == nil {
+		t.Error("no error without files")
+	}
+}
+
+func TestDrillSamplerPaths(t *testing.T) {
+	sampler := newDrillSampler([]string{"/data/b", "/data/a"}, 5)
+	for _, path := range []string{"/data/a", "/data/b", "/data/c"} {
+		sampler.add(resticNode{Type: "file", Path: path, Size: len(path)})
+	}
+	sample, err := sampler.selected()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sample) != 2 || sample[0].Path != "/data/b" || sample[1].Path != "/data/a" {
+		t.Errorf("unexpected sample %v", sample)
+	}
+
+	sampler = newDrillSampler([]string{"/data/missing"}, 5)
+	sampler.add(resticNode{Type: "file", Path: "/data/a"})
+	if _, err := sampler.selected(); err == nil || !strings.Contains(err.Error(), "/data/missing") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestListLatestSnapshot(t *testing.T) {
+	listing := `{"time":"2024-05-02T01:00:00Z","paths":["/data"],"hostname":"web1","id":"1a2b3c4d5e6f","short_id":"1a2b3c4d","struct_type":"snapshot"}
+{"name":"data","type":"dir","path":"/data","struct_type":"node"}
+{"name":"a","type":"file","path":"/data/a","size":3,"struct_type":"node"}
+{"name":"b","type":"file","path":"/data/b","size":5,"struct_type":"node"}
+`
+	bm, executor := newTestManager(t, "", []Utils.ScriptRule{{Match: ` ls --tag=web1 latest --json$`, Stdout: listing}})
+	snapshotId, sample, err := bm.listLatestSnapshot(nil, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshotId != "1a2b3c4d5e6f" || len(sample) != 2 || sample[0].Path != "/data/a" || sample[1].Size != 5 {
+		t.Errorf("snapshot %s, sample %v", snapshotId, sample)
+	}
+	if calls := executor.Calls(); len(calls) != 1 {
+		t.Errorf("commands %v, expected restic ls", calls)
+	}
+
+	bm, _ = newTestManager(t, "", []Utils.ScriptRule{{Match: ` ls `, Stdout: "Fatal: not json\n"}})
+	if _, _, err := bm.listLatestSnapshot(nil, 5); err == nil || !strings.Contains(err.Error(), "invalid output") {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	bm, _ = newTestManager(t, "", []Utils.ScriptRule{{Match: ` ls `, Stderr: "Fatal: no snapshot found\n", ExitCode: 1}})
+	if _, _, err := bm.listLatestSnapshot(nil, 5); err == nil || !strings.Contains(err.Error(), "no snapshot found") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestDrillMetrics(t *testing.T) {
+	bm := &BackupManager{
+		Drill:       &DrillResult{SnapshotId: "1a2b3c4d5e6f", Files: 3, Bytes: 2048},
+		StepResults: []BackupStepResult{{ShortName: "Drill", Status: Success}},
+	}
+	metrics := strings.Join(bm.getDrillMetrics(&Utils.PrometheusLabels{"repository": "files"}), "")
+	for _, expected := range []string{
+		"backup_drill_status{repository=\"files\"} 1\n",
+		"backup_drill_files{repository=\"files\"} 3\n",
+		"backup_drill_bytes{repository=\"files\"} 2048\n",
+	} {
+		if !strings.Contains(metrics, expected) {
+			t.Errorf("'%s' missing in:\n%s", expected, metrics)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package Services
+
+import (
+	"gobackup/src/Utils"
+	"sort"
+	"strings"
+)
+
+// printDryRun shows a command instead of executing it. The environment
+// variables given to the command are only listed, and every secret of the
+// configuration is masked.
+func (bm *BackupManager) printDryRun(command string, envs map[string]string) {
+	keys := make([]string, 0, len(envs))
+	for k := range envs {
+		keys = append(keys, k+"=********")
+	}
+	sort.Strings(keys)
+	line := strings.TrimSpace(strings.Join(keys, " ") + " " + command)
+	bm.log().Info("[dry-run] " + Utils.MaskSecrets(line, bm.Config.Secrets()))
+}
+
+func (bm *BackupManager) dryRunResult(result *BackupStepResult, command string, envs map[string]string) {
+	bm.printDryRun(command, envs)
+	result.Output = "Not executed (dry-run): " + Utils.MaskSecrets(command, bm.Config.Secrets())
+	result.Status = Success
+	bm.StepResults = append(bm.StepResults, *result)
+	bm.LastResult = result
+}
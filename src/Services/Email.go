@@ -2,12 +2,20 @@ package Services
 
 import (
 	"bytes"
+	"encoding/base64"
 	"errors"
 	"fmt"
+	"github.com/sirupsen/logrus"
 	"gobackup/src/Model"
 	"gobackup/src/Utils"
+	"io/ioutil"
 	"math"
+	"mime/multipart"
 	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -16,6 +24,7 @@ type EmailServer struct {
 	Port     int
 	MaxRetry int
 	Password string
+	Logger   logrus.FieldLogger
 }
 
 type Email struct {
@@ -23,8 +32,12 @@ type Email struct {
 	To      string
 	Subject string
 	Body    string
+	// Attachments are file paths, the larger files are only named in the body
+	Attachments []string
 }
 
+const maxAttachmentSize = 10 << 20
+
 func NewEmailServer(config *Model.Config) (*EmailServer, error) {
 	server := &EmailServer{}
 	if config.BackupConfig.Email.Host == "" {
@@ -34,23 +47,89 @@ func NewEmailServer(config *Model.Config) (*EmailServer, error) {
 	server.Port = config.BackupConfig.Email.Port
 	server.MaxRetry = config.BackupConfig.Email.MaxTry
 	server.Password = config.BackupConfig.Email.Password
+	server.Logger = Utils.GetLogger()
 	return server, nil
 }
 
 func (e *EmailServer) Send(email *Email) error {
 	var err error
 	for i := 1; i <= e.MaxRetry; i++ {
-		err := sendEmail(e.Host, e.Port, email.From, e.Password, email.To, email.Body)
+		err = sendEmail(e.Host, e.Port, email.From, e.Password, email.To, email.message())
 		if err == nil {
 			break
 		}
-		Utils.GetLogger().Debug(fmt.Sprintf("Error sending email, try %d/%d (%s)", i, e.MaxRetry, err))
+		e.Logger.Debug(fmt.Sprintf("Error sending email, try %d/%d (%s)", i, e.MaxRetry, err))
 		time.Sleep(time.Duration(math.Pow(3, float64(i))) * time.Second)
 	}
 	return err
 }
 
-func sendEmail(host string, port int, from string, password string, to string, body string) error {
+// message returns the body, in a multipart message when files are attached.
+func (email *Email) message() []byte {
+	if len(email.Attachments) == 0 {
+		return []byte(email.Body)
+	}
+	// The body starts with the headers, separated from the text by an empty line
+	headers, text := "", email.Body
+	if i := strings.Index(email.Body, "\n\n"); i >= 0 {
+		headers, text = email.Body[:i+1], email.Body[i+2:]
+	}
+
+	var content bytes.Buffer
+	writer := multipart.NewWriter(&content)
+	var names []string
+	var attachments [][]byte
+	for _, file := range email.Attachments {
+		data, err := readAttachment(file)
+		if err != nil {
+			text += fmt.Sprintf("\nOutput not attached (%s): %s", err, file)
+			continue
+		}
+		names = append(names, filepath.Base(file))
+		attachments = append(attachments, data)
+	}
+	part, _ := writer.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/plain; charset=utf-8"}})
+	_, _ = part.Write([]byte(text))
+	for i, data := range attachments {
+		part, _ = writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {"text/plain; charset=utf-8"},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {fmt.Sprintf(`attachment; filename="%s"`, names[i])},
+		})
+		_, _ = part.Write(base64Lines(data))
+	}
+	_ = writer.Close()
+
+	return []byte(headers +
+		"MIME-Version: 1.0\n" +
+		"Content-Type: multipart/mixed; boundary=" + writer.Boundary() + "\n\n" +
+		content.String())
+}
+
+func readAttachment(file string) ([]byte, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > maxAttachmentSize {
+		return nil, fmt.Errorf("larger than %s", Utils.HumanBytes(maxAttachmentSize))
+	}
+	return ioutil.ReadFile(file)
+}
+
+// base64Lines encodes the data in lines of 76 characters, as required in emails.
+func base64Lines(data []byte) []byte {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	var lines bytes.Buffer
+	for len(encoded) > 76 {
+		lines.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	lines.WriteString(encoded + "\r\n")
+	return lines.Bytes()
+}
+
+func sendEmail(host string, port int, from string, password string, to string, body []byte) error {
 	auth := smtp.PlainAuth("", from, password, host)
 	c, err := smtp.Dial(fmt.Sprintf("%s:%d", host, port))
 	if err != nil {
@@ -71,7 +150,7 @@ func sendEmail(host string, port int, from string, password string, to string, b
 	if err != nil {
 		return err
 	}
-	_, err = w.Write(bytes.NewBufferString(body).Bytes())
+	_, err = w.Write(body)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,317 @@
+package Services
+
+import (
+	"bytes"
+	"fmt"
+	"gobackup/src/Model"
+	"gobackup/src/Utils"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// cacheDirTag marks the cache folders skipped by --exclude-caches
+const cacheDirTag = "CACHEDIR.TAG:Signature: 8a477f597d28d172789f06886806bc55"
+
+// exclusionOptions returns the restic backup options of the exclusions.
+func exclusionOptions(exclusions Model.Exclusions) string {
+	options := make([]string, 0)
+	for _, file := range exclusions.ExcludeFile {
+		options = append(options, "--exclude-file="+file)
+	}
+	for _, pattern := range exclusions.Exclude {
+		options = append(options, "--exclude="+pattern)
+	}
+	for _, pattern := range exclusions.IExclude {
+		options = append(options, "--iexclude="+pattern)
+	}
+	for _, name := range exclusions.ExcludeIfPresent {
+		options = append(options, "--exclude-if-present="+name)
+	}
+	if exclusions.ExcludeCaches {
+		options = append(options, "--exclude-caches")
+	}
+	if exclusions.ExcludeLargerThan != "" {
+		options = append(options, "--exclude-larger-than="+exclusions.ExcludeLargerThan)
+	}
+	if exclusions.OneFileSystem {
+		options = append(options, "--one-file-system")
+	}
+	return strings.Join(options, " ")
+}
+
+type ExclusionRule struct {
+	Rule    string `json:"rule"`
+	Matches int    `json:"matches"`
+	Size    int    `json:"size"`
+}
+
+type ExcludedPath struct {
+	Path string `json:"path"`
+	Dir  bool   `json:"dir"`
+	Size int    `json:"size"`
+	Rule string `json:"rule"`
+}
+
+// UnreachedRule is a negated rule matching a path inside an excluded folder,
+// restic doesn't walk the folder so the path stays excluded.
+type UnreachedRule struct {
+	Rule   string `json:"rule"`
+	Folder string `json:"folder"`
+}
+
+// ExclusionReport lists the paths excluded from the folders, an excluded
+// folder is listed once with the size of its content.
+type ExclusionReport struct {
+	Excluded  []ExcludedPath  `json:"excluded"`
+	Size      int             `json:"size"`
+	Rules     []ExclusionRule `json:"rules"`
+	Unreached []UnreachedRule `json:"unreached,omitempty"`
+	Errors    []string        `json:"errors,omitempty"`
+}
+
+// Unused returns the rules that matched nothing.
+func (r *ExclusionReport) Unused() []string {
+	unused := make([]string, 0)
+	for _, rule := range r.Rules {
+		if rule.Matches == 0 {
+			unused = append(unused, rule.Rule)
+		}
+	}
+	return unused
+}
+
+type tagFileRule struct {
+	tag  string
+	rule int
+}
+
+type exclusionWalker struct {
+	report       *ExclusionReport
+	patterns     []Utils.Pattern
+	patternRules []int
+	tagFiles     []tagFileRule
+	largerThan   int
+	largerRule   int
+	deviceRule   int
+	rootDevice   uint64
+}
+
+// TestExclusions walks the folders and applies the exclusions as restic
+// backup does, without reading the content of the files.
+func TestExclusions(exclusions Model.Exclusions, folders []string) (*ExclusionReport, error) {
+	w := &exclusionWalker{report: &ExclusionReport{Excluded: make([]ExcludedPath, 0)}, largerRule: -1, deviceRule: -1}
+	for _, file := range exclusions.ExcludeFile {
+		patterns, err := Utils.ReadPatternFile(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, pattern := range patterns {
+			w.addPattern(file+": "+pattern, Utils.ParsePattern(pattern, false))
+		}
+	}
+	for _, pattern := range exclusions.Exclude {
+		w.addPattern("exclude: "+pattern, Utils.ParsePattern(pattern, false))
+	}
+	for _, pattern := range exclusions.IExclude {
+		w.addPattern("iexclude: "+pattern, Utils.ParsePattern(pattern, true))
+	}
+	for _, name := range exclusions.ExcludeIfPresent {
+		w.tagFiles = append(w.tagFiles, tagFileRule{tag: name, rule: w.addRule("exclude_if_present: " + name)})
+	}
+	if exclusions.ExcludeCaches {
+		w.tagFiles = append(w.tagFiles, tagFileRule{tag: cacheDirTag, rule: w.addRule("exclude_caches")})
+	}
+	if exclusions.ExcludeLargerThan != "" {
+		larger, err := parseExclusionSize(exclusions.ExcludeLargerThan)
+		if err != nil {
+			return nil, err
+		}
+		w.largerThan = larger
+		w.largerRule = w.addRule("exclude_larger_than: " + exclusions.ExcludeLargerThan)
+	}
+	if exclusions.OneFileSystem {
+		w.deviceRule = w.addRule("one_file_system")
+	}
+
+	for _, folder := range folders {
+		root, err := filepath.Abs(folder)
+		if err != nil {
+			return nil, err
+		}
+		info, err := os.Lstat(root)
+		if err != nil {
+			return nil, err
+		}
+		w.rootDevice = deviceOf(info)
+		_ = filepath.WalkDir(root, w.visit)
+	}
+	return w.report, nil
+}
+
+func (w *exclusionWalker) addRule(rule string) int {
+	w.report.Rules = append(w.report.Rules, ExclusionRule{Rule: rule})
+	return len(w.report.Rules) - 1
+}
+
+func (w *exclusionWalker) addPattern(rule string, pattern Utils.Pattern) {
+	w.patterns = append(w.patterns, pattern)
+	w.patternRules = append(w.patternRules, w.addRule(rule))
+}
+
+func (w *exclusionWalker) visit(path string, entry fs.DirEntry, err error) error {
+	if err != nil {
+		w.report.Errors = append(w.report.Errors, err.Error())
+		return nil
+	}
+	info, err := entry.Info()
+	if err != nil {
+		w.report.Errors = append(w.report.Errors, err.Error())
+		return nil
+	}
+	w.countNegations(path)
+	rule := w.rejectedBy(path, info)
+	if rule < 0 {
+		return nil
+	}
+	excluded := ExcludedPath{Path: path, Dir: info.IsDir(), Size: int(info.Size()), Rule: w.report.Rules[rule].Rule}
+	if info.IsDir() {
+		excluded.Size = folderSize(path)
+		w.findUnreached(path)
+	}
+	w.report.Excluded = append(w.report.Excluded, excluded)
+	w.report.Size += excluded.Size
+	w.report.Rules[rule].Matches++
+	w.report.Rules[rule].Size += excluded.Size
+	if info.IsDir() {
+		return filepath.SkipDir
+	}
+	return nil
+}
+
+// countNegations counts the negated patterns including back the path, a
+// negated pattern only matters after a pattern excluding the same path.
+func (w *exclusionWalker) countNegations(path string) {
+	excluded := false
+	for i, pattern := range w.patterns {
+		if !pattern.Match(path) {
+			continue
+		}
+		if !pattern.Negated {
+			excluded = true
+		} else if excluded {
+			excluded = false
+			w.report.Rules[w.patternRules[i]].Matches++
+		}
+	}
+}
+
+// findUnreached lists the negated patterns matching a path of the excluded
+// folder, restic never applies them as it doesn't walk the folder.
+func (w *exclusionWalker) findUnreached(dir string) {
+	negated := make([]int, 0)
+	for i, pattern := range w.patterns {
+		if pattern.Negated {
+			negated = append(negated, i)
+		}
+	}
+	if len(negated) == 0 {
+		return
+	}
+	found := make(map[int]bool)
+	_ = filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || path == dir {
+			return nil
+		}
+		for _, i := range negated {
+			if !found[i] && w.patterns[i].Match(path) {
+				found[i] = true
+				w.report.Unreached = append(w.report.Unreached, UnreachedRule{Rule: w.report.Rules[w.patternRules[i]].Rule, Folder: dir})
+			}
+		}
+		return nil
+	})
+}
+
+// rejectedBy returns the index of the rule excluding the path, -1 if the
+// path is kept. The rules are applied in the order of restic.
+func (w *exclusionWalker) rejectedBy(path string, info fs.FileInfo) int {
+	if excluded, index := Utils.MatchPatterns(w.patterns, path); excluded {
+		return w.patternRules[index]
+	}
+	if info.IsDir() {
+		for _, tagFile := range w.tagFiles {
+			if containsTagFile(path, tagFile.tag) {
+				return tagFile.rule
+			}
+		}
+	}
+	if w.deviceRule >= 0 && deviceOf(info) != w.rootDevice {
+		return w.deviceRule
+	}
+	if w.largerRule >= 0 && info.Mode().IsRegular() && int(info.Size()) > w.largerThan {
+		return w.largerRule
+	}
+	return -1
+}
+
+// containsTagFile tells if the folder contains the file, given as
+// <name>[:<header>] where the file must start with the header.
+func containsTagFile(dir string, tag string) bool {
+	name, header := tag, ""
+	if i := strings.Index(tag, ":"); i >= 0 {
+		name, header = tag[:i], tag[i+1:]
+	}
+	file, err := os.Open(filepath.Join(dir, name))
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	if header == "" {
+		return true
+	}
+	content := make([]byte, len(header))
+	if _, err := io.ReadFull(file, content); err != nil {
+		return false
+	}
+	return bytes.Equal(content, []byte(header))
+}
+
+func folderSize(root string) int {
+	size := 0
+	_ = filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err == nil && entry.Type().IsRegular() {
+			if info, err := entry.Info(); err == nil {
+				size += int(info.Size())
+			}
+		}
+		return nil
+	})
+	return size
+}
+
+func deviceOf(info fs.FileInfo) uint64 {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(stat.Dev)
+	}
+	return 0
+}
+
+// parseExclusionSize converts a size given to restic (500M, 2G) to bytes.
+func parseExclusionSize(size string) (int, error) {
+	units := map[string]int{"K": 1 << 10, "M": 1 << 20, "G": 1 << 30, "T": 1 << 40}
+	multiplier := 1
+	if unit, ok := units[strings.ToUpper(size[len(size)-1:])]; ok {
+		multiplier = unit
+		size = size[:len(size)-1]
+	}
+	value, err := strconv.Atoi(size)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size '%s'", size)
+	}
+	return value * multiplier, nil
+}
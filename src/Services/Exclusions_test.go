@@ -0,0 +1,52 @@
+package Services
+
+import (
+	"gobackup/src/Model"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExclusionsNegatedRules(t *testing.T) {
+	dir := t.TempDir()
+	for _, file := range []string{"logs/app/access.log", "logs/kern.log", "cache/keep/data", "data/file"} {
+		path := filepath.Join(dir, file)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte("content"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	exclusions := Model.Exclusions{Exclude: []string{
+		dir + "/logs/*",
+		"!" + dir + "/logs/app",
+		dir + "/cache",
+		"!" + dir + "/cache/keep",
+		"!" + dir + "/data",
+	}}
+	report, err := TestExclusions(exclusions, []string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	excluded := make([]string, 0)
+	for _, path := range report.Excluded {
+		excluded = append(excluded, path.Path)
+	}
+	if expected := []string{dir + "/cache", dir + "/logs/kern.log"}; !reflect.DeepEqual(excluded, expected) {
+		t.Errorf("excluded %v, expected %v", excluded, expected)
+	}
+	// The negated rule of data includes back nothing, the one of cache/keep is inside an excluded folder
+	expected := []string{"exclude: !" + dir + "/cache/keep", "exclude: !" + dir + "/data"}
+	if unused := report.Unused(); !reflect.DeepEqual(unused, expected) {
+		t.Errorf("unused rules %v, expected %v", unused, expected)
+	}
+	unreached := []UnreachedRule{{Rule: "exclude: !" + dir + "/cache/keep", Folder: dir + "/cache"}}
+	if !reflect.DeepEqual(report.Unreached, unreached) {
+		t.Errorf("unreached rules %v, expected %v", report.Unreached, unreached)
+	}
+}
@@ -0,0 +1,39 @@
+package Services
+
+import (
+	"gobackup/src/Utils"
+	"strings"
+)
+
+// ExitCode returns the exit code of the run, from the final status and the
+// first failed step. The other steps are skipped after a failure.
+func (bm *BackupManager) ExitCode() int {
+	switch getFinalStatus(bm.StepResults) {
+	case Failed:
+		for _, result := range bm.StepResults {
+			if result.Status == Failed {
+				return stepExitCode(result.ShortName)
+			}
+		}
+	case Warning:
+		for _, result := range bm.StepResults {
+			if result.Status == Warning && strings.HasPrefix(result.ShortName, "StartBackup") {
+				return Utils.ExitPartial
+			}
+		}
+	}
+	return Utils.ExitSuccess
+}
+
+func stepExitCode(shortName string) int {
+	switch {
+	case shortName == "OpenRepo" || shortName == "InitRepo":
+		return Utils.ExitPreflight
+	case strings.HasPrefix(shortName, "Hook-"):
+		return Utils.ExitHook
+	case shortName == "Forget" || strings.HasPrefix(shortName, "Forget-") ||
+		shortName == "Prune" || shortName == "CheckRepoIntegrity" || shortName == "Drill":
+		return Utils.ExitMaintenance
+	}
+	return Utils.ExitBackup
+}
@@ -0,0 +1,118 @@
+package Services
+
+import (
+	"bufio"
+	"encoding/json"
+	"gobackup/src/Utils"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const historyFilename = "history.jsonl"
+
+// HistoryEntry is the result of a run, one json line per run is appended to
+// the history file of the state directory.
+type HistoryEntry struct {
+	Time       time.Time         `json:"time"`
+	Job        string            `json:"job"`
+	Repository string            `json:"repository"`
+	Tags       []string          `json:"tags,omitempty"`
+	Status     string            `json:"status"`
+	Duration   float64           `json:"duration_seconds"`
+	Steps      []HistoryStep     `json:"steps"`
+	Stats      Utils.ResticStats `json:"stats"`
+	Size       *RepositorySize   `json:"repository_size,omitempty"`
+	Resources  *AppliedResources `json:"resources,omitempty"`
+}
+
+type HistoryStep struct {
+	Name     string  `json:"name"`
+	Status   string  `json:"status"`
+	Duration float64 `json:"duration_seconds"`
+}
+
+func AppendHistory(dir string, entry HistoryEntry) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	content, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, historyFilename), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(content, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadHistory returns the runs of the history file, oldest first. Unreadable
+// lines, from an interrupted write, are skipped.
+func ReadHistory(dir string) ([]HistoryEntry, error) {
+	entries := make([]HistoryEntry, 0)
+	f, err := os.Open(filepath.Join(dir, historyFilename))
+	if os.IsNotExist(err) {
+		return entries, nil
+	}
+	if err != nil {
+		return entries, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		var entry HistoryEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// LastRun returns the latest run on the repository.
+func LastRun(entries []HistoryEntry, repository string) (HistoryEntry, bool) {
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].Repository == repository {
+			return entries[i], true
+		}
+	}
+	return HistoryEntry{}, false
+}
+
+// RecordHistory appends the result of this run to the history.
+func (bm *BackupManager) RecordHistory() {
+	if bm.DryRun {
+		return
+	}
+	entry := HistoryEntry{
+		Time:       bm.StartTime,
+		Repository: bm.Config.Repository,
+		Status:     getFinalStatus(bm.StepResults).String(),
+		Duration:   time.Now().Sub(bm.StartTime).Seconds(),
+		Steps:      make([]HistoryStep, 0, len(bm.StepResults)),
+		Stats:      *bm.GetResticStats(),
+		Size:       bm.RepositorySize,
+		Resources:  bm.Resources,
+		Tags:       bm.tags,
+	}
+	if bm.Job != nil {
+		entry.Job = bm.Job.Name
+	}
+	for _, res := range bm.StepResults {
+		entry.Steps = append(entry.Steps, HistoryStep{
+			Name:     strings.ToLower(res.ShortName),
+			Status:   res.Status.String(),
+			Duration: res.Duration.Seconds(),
+		})
+	}
+	err := AppendHistory(bm.Config.BackupConfig.StateDir, entry)
+	Utils.WarnOnError(bm.log(), err, "Impossible to save the history", nil)
+}
@@ -0,0 +1,135 @@
+package Services
+
+import (
+	"fmt"
+	"gobackup/src/Model"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	PreBackupHooks  = "pre_backup"
+	PostBackupHooks = "post_backup"
+	OnSuccessHooks  = "on_success"
+	OnFailureHooks  = "on_failure"
+	AlwaysHooks     = "always"
+)
+
+// RunHooks executes the hooks of a stage. A failing hook fails the backup
+// when it is flagged abort_on_error, otherwise it is reported as a warning.
+// Only the pre_backup hooks are skipped after a failure, the other stages
+// always run to let the hooks restore services or report the failure.
+func (bm *BackupManager) RunHooks(stage string) {
+	for _, hook := range bm.stageHooks(stage) {
+		if stage == PreBackupHooks && !bm.isLastResultSuccess() {
+			return
+		}
+		bm.runHook(stage, hook)
+	}
+}
+
+// RunFinalHooks executes the on_success or on_failure hooks depending on the
+// backup status, then the always hooks.
+func (bm *BackupManager) RunFinalHooks() {
+	if getFinalStatus(bm.StepResults) == Failed {
+		bm.RunHooks(OnFailureHooks)
+	} else {
+		bm.RunHooks(OnSuccessHooks)
+	}
+	bm.RunHooks(AlwaysHooks)
+}
+
+func (bm *BackupManager) stageHooks(stage string) []Model.Hook {
+	hooks := bm.Config.BackupConfig.Hooks
+	switch stage {
+	case PreBackupHooks:
+		return hooks.PreBackup
+	case PostBackupHooks:
+		return hooks.PostBackup
+	case OnSuccessHooks:
+		return hooks.OnSuccess
+	case OnFailureHooks:
+		return hooks.OnFailure
+	case AlwaysHooks:
+		return hooks.Always
+	}
+	return nil
+}
+
+func (bm *BackupManager) runHook(stage string, hook Model.Hook) {
+	result := BackupStepResult{
+		Name:      fmt.Sprintf("Hook %s: %s", stage, hook.Name),
+		ShortName: fmt.Sprintf("Hook-%s-%s", stage, hook.Name),
+	}
+	bm.logStep(&result)
+	if bm.DryRun {
+		bm.dryRunResult(&result, hook.Command, nil)
+		return
+	}
+	startTime := time.Now()
+
+	options := bm.commandOptions(bm.hookEnvs(stage))
+	options.Timeout = hook.Timeout
+	options.Shell = true
+	res, err := bm.Executor.Execute(hook.Command, options)
+	bm.keepOutput(res)
+	if stage == PreBackupHooks {
+		bm.parseHookTags(res.Stdout())
+	}
+	result.Output = res.Output
+	result.Status = Success
+
+	if err != nil {
+		result.Output += "\n" + err.Error()
+		if hook.AbortOnError {
+			result.Status = Failed
+		} else {
+			result.Status = Warning
+			bm.log().Warning("Error during hook '" + hook.Name + "'\n" + err.Error())
+		}
+	}
+	endTime := time.Now()
+	result.Duration = endTime.Sub(startTime)
+	bm.StepResults = append(bm.StepResults, result)
+	bm.LastResult = &result
+}
+
+func (bm *BackupManager) hookEnvs(stage string) map[string]string {
+	stats := bm.GetResticStats()
+	status := "running"
+	failedStep := ""
+	var duration time.Duration
+	for _, res := range bm.StepResults {
+		if res.Status == Failed && failedStep == "" {
+			failedStep = res.ShortName
+		}
+		duration += res.Duration
+	}
+	if stage != PreBackupHooks {
+		status = getFinalStatus(bm.StepResults).String()
+	}
+	bm.renderTags()
+
+	return map[string]string{
+		"GOBACKUP_HOOK_STAGE":        stage,
+		"GOBACKUP_TAGS":              strings.Join(bm.tags, ","),
+		"GOBACKUP_STATUS":            status,
+		"GOBACKUP_FAILED_STEP":       failedStep,
+		"GOBACKUP_CLIENT_NAME":       bm.Config.BackupConfig.Information.ClientName,
+		"GOBACKUP_SERVER_NAME":       bm.Config.BackupConfig.Information.ServerName,
+		"GOBACKUP_REPOSITORY":        bm.Config.Repository,
+		"GOBACKUP_SNAPSHOT_ID":       stats.SnapshotId,
+		"GOBACKUP_FILES_NEW":         strconv.Itoa(stats.FilesNew),
+		"GOBACKUP_FILES_CHANGED":     strconv.Itoa(stats.FilesChanged),
+		"GOBACKUP_FILES_UNMODIFIED":  strconv.Itoa(stats.FilesUnmodified),
+		"GOBACKUP_DIRS_NEW":          strconv.Itoa(stats.DirsNew),
+		"GOBACKUP_DIRS_CHANGED":      strconv.Itoa(stats.DirsChanged),
+		"GOBACKUP_DIRS_UNMODIFIED":   strconv.Itoa(stats.DirsUnmodified),
+		"GOBACKUP_BYTES_ADDED":       strconv.Itoa(stats.BytesAdded),
+		"GOBACKUP_BYTES_PROCESSED":   strconv.Itoa(stats.BytesProcessed),
+		"GOBACKUP_SNAPSHOTS_KEPT":    strconv.Itoa(stats.KeptSnapshots),
+		"GOBACKUP_SNAPSHOTS_REMOVED": strconv.Itoa(stats.RemovedSnapshots),
+		"GOBACKUP_DURATION":          strconv.Itoa(int(duration.Seconds())),
+	}
+}
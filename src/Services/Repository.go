@@ -0,0 +1,135 @@
+package Services
+
+import (
+	"fmt"
+	"gobackup/src/Model"
+	"gobackup/src/Utils"
+	"os"
+	"strings"
+	"time"
+)
+
+type InitOptions struct {
+	// FromRepository is the name of the repository to copy the chunker parameters from
+	FromRepository string
+	// CopyTarget initializes a secondary repository of the job instead of the
+	// job repository, the chunker parameters are copied from the job repository
+	CopyTarget        *Model.CopyTarget
+	CopyChunkerParams bool
+	RepositoryVersion string
+}
+
+// InitRepo creates the repository, it fails if the repository already exists.
+func (bm *BackupManager) InitRepo(initOptions InitOptions) {
+	result := BackupStepResult{
+		Name:      "Initialize Repository",
+		ShortName: "InitRepo",
+	}
+	bm.logStep(&result)
+	if !bm.isLastResultSuccess() {
+		return
+	}
+
+	options := make([]string, 0)
+	version := initOptions.RepositoryVersion
+	if version == "" {
+		version = bm.Config.BackupConfig.Repository.Version
+	}
+	if version != "" {
+		options = append(options, "--repository-version="+version)
+	}
+	if initOptions.CopyChunkerParams {
+		options = append(options, "--copy-chunker-params")
+	}
+	url, password := bm.repositoryUrl(bm.Config.Repository), bm.Config.ResticPassword
+	fromPassword := bm.Config.ResticPassword
+	if target := initOptions.CopyTarget; target != nil {
+		var err error
+		url = bm.copyTargetUrl(*target)
+		if password, err = bm.copyTargetPassword(*target); err != nil {
+			result.Output = err.Error()
+			result.Status = Failed
+			bm.appendResult(&result, time.Now())
+			bm.LastResult = &result
+			return
+		}
+		options = append(options, "--from-repo="+bm.repositoryUrl(bm.Config.Repository))
+		if !initOptions.CopyChunkerParams {
+			options = append(options, "--copy-chunker-params")
+		}
+	} else if initOptions.FromRepository != "" {
+		options = append(options, "--from-repo="+bm.repositoryUrl(initOptions.FromRepository))
+		if password, ok := os.LookupEnv("RESTIC_FROM_PASSWORD"); ok && password != "" {
+			fromPassword = password
+		}
+	}
+	cmd, envs := bm.resticCommandOn(url, password, createBashCommand(append([]string{"init"}, options...)...))
+	if initOptions.CopyTarget != nil || initOptions.FromRepository != "" {
+		envs["RESTIC_FROM_PASSWORD"] = fromPassword
+	}
+	if bm.DryRun {
+		bm.dryRunResult(&result, cmd, envs)
+		return
+	}
+
+	startTime := time.Now()
+	res, _ := bm.executeResticCommand(cmd, envs)
+	result.Output = res.Output
+	result.Status = Success
+
+	if res.ExitCode != 0 {
+		result.Status = Failed
+	}
+	if strings.Contains(res.Output, "already exists") {
+		result.Output += "\nThe repository '" + url + "' is already initialized"
+	}
+	endTime := time.Now()
+	result.Duration = endTime.Sub(startTime)
+	bm.StepResults = append(bm.StepResults, result)
+	bm.LastResult = &result
+}
+
+// OpenRepo checks that the repository exists before backing up, a typo in a
+// repository name must not silently create a new repository. Missing
+// repositories are only initialized when repository.auto_init is enabled.
+func (bm *BackupManager) OpenRepo() {
+	result := BackupStepResult{
+		Name:      "Open Repository",
+		ShortName: "OpenRepo",
+	}
+	bm.logStep(&result)
+	if !bm.isLastResultSuccess() {
+		return
+	}
+	startTime := time.Now()
+	res, _ := bm.ExecuteRestic("cat config")
+	result.Status = Success
+	// The configuration is printed on success, only keep the errors
+	if res.ExitCode != 0 {
+		result.Output = res.Output
+		result.Status = Failed
+	}
+
+	if result.Status == Failed && isMissingRepository(res) {
+		if bm.Config.BackupConfig.Repository.AutoInit {
+			bm.log().Info("Repository '" + bm.Config.Repository + "' does not exist, initializing it")
+			bm.InitRepo(InitOptions{})
+			return
+		}
+		result.Output += fmt.Sprintf(
+			"\nThe repository '%s' does not exist, initialize it with 'gobackup init -r %s' or set 'repository.auto_init'",
+			bm.Config.Repository, bm.Config.Repository,
+		)
+	}
+	endTime := time.Now()
+	result.Duration = endTime.Sub(startTime)
+	bm.StepResults = append(bm.StepResults, result)
+	bm.LastResult = &result
+}
+
+func isMissingRepository(res Utils.CommandResult) bool {
+	// restic >= 0.17 exits with 10 when the repository does not exist
+	return res.ExitCode == 10 ||
+		strings.Contains(res.Output, "Is there a repository at the following location?") ||
+		strings.Contains(res.Output, "unable to open config file")
+}
@@ -0,0 +1,153 @@
+package Services
+
+import (
+	"fmt"
+	"gobackup/src/Utils"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+var ioniceClasses = map[string]int{
+	"realtime":    1,
+	"best-effort": 2,
+	"idle":        3,
+}
+
+// AppliedResources are the resources actually given to the child processes,
+// nice and ionice are ignored when the binaries are missing.
+type AppliedResources struct {
+	Nice            int    `json:"nice,omitempty"`
+	IoniceClass     string `json:"ionice_class,omitempty"`
+	IoniceLevel     int    `json:"ionice_level,omitempty"`
+	GoMaxProcs      int    `json:"gomaxprocs,omitempty"`
+	GoGC            int    `json:"gogc,omitempty"`
+	ReadConcurrency int    `json:"read_concurrency,omitempty"`
+	PackSize        int    `json:"pack_size,omitempty"`
+}
+
+func (bm *BackupManager) initResources() {
+	resources := bm.Config.BackupConfig.Resources
+	if bm.Job != nil && bm.Job.Resources != nil {
+		resources = *bm.Job.Resources
+	}
+	applied := &AppliedResources{
+		GoMaxProcs:      resources.GoMaxProcs,
+		GoGC:            resources.GoGC,
+		ReadConcurrency: resources.ReadConcurrency,
+		PackSize:        resources.PackSize,
+	}
+	// nice and ionice can only be looked for on this host
+	local := bm.Config.BackupConfig.JobExecutor(bm.Job).IsLocal()
+	if resources.Nice != 0 {
+		if _, err := exec.LookPath("nice"); local && err != nil {
+			bm.log().Warning("nice not found, the priority of the commands is not changed")
+		} else {
+			applied.Nice = resources.Nice
+		}
+	}
+	if resources.IoniceClass != "" {
+		if _, err := exec.LookPath("ionice"); local && err != nil {
+			bm.log().Warning("ionice not found, the io priority of the commands is not changed")
+		} else {
+			applied.IoniceClass = resources.IoniceClass
+			applied.IoniceLevel = resources.IoniceLevel
+		}
+	}
+	bm.Resources = applied
+}
+
+// commandOptions returns the options of a child process, with the priority of
+// the job. The whole outputs are not saved in dry-run.
+func (bm *BackupManager) commandOptions(envs map[string]string) Utils.CommandOptions {
+	output := bm.Config.BackupConfig.Output
+	options := Utils.CommandOptions{
+		Envs:           envs,
+		Priority:       bm.priority(),
+		MaxOutputLines: output.Lines(),
+		OutputDir:      output.Dir,
+		Context:        bm.ctx,
+		Logger:         bm.log(),
+	}
+	if bm.DryRun {
+		options.OutputDir = ""
+	}
+	return options
+}
+
+// removeOldOutputs removes the saved outputs older than output.max_age.
+func (bm *BackupManager) removeOldOutputs() {
+	if output := bm.Config.BackupConfig.Output; output.MaxAge > 0 && !bm.DryRun {
+		Utils.RemoveOldOutputs(output.Dir, bm.StartTime.Add(-output.MaxAge))
+	}
+}
+
+// keepOutput records the file with the whole output of a command, to attach it to the report.
+func (bm *BackupManager) keepOutput(results ...Utils.CommandResult) {
+	for _, res := range results {
+		if res.LogFile != "" {
+			bm.OutputFiles = append(bm.OutputFiles, res.LogFile)
+		}
+	}
+}
+
+func (bm *BackupManager) priority() Utils.Priority {
+	if bm.Resources == nil {
+		return Utils.Priority{}
+	}
+	return Utils.Priority{
+		Nice:        bm.Resources.Nice,
+		IoniceClass: ioniceClasses[bm.Resources.IoniceClass],
+		IoniceLevel: bm.Resources.IoniceLevel,
+	}
+}
+
+// resticResources adds the go runtime settings and the pack size to a restic command.
+func (bm *BackupManager) resticResources(envs map[string]string) string {
+	if bm.Resources == nil {
+		return ""
+	}
+	if bm.Resources.GoMaxProcs > 0 {
+		envs["GOMAXPROCS"] = strconv.Itoa(bm.Resources.GoMaxProcs)
+	}
+	if bm.Resources.GoGC == -1 {
+		envs["GOGC"] = "off"
+	} else if bm.Resources.GoGC > 0 {
+		envs["GOGC"] = strconv.Itoa(bm.Resources.GoGC)
+	}
+	if bm.Resources.PackSize > 0 {
+		return fmt.Sprintf("--pack-size=%d", bm.Resources.PackSize)
+	}
+	return ""
+}
+
+func (r *AppliedResources) String() string {
+	if r == nil {
+		return ""
+	}
+	var values []string
+	if r.Nice != 0 {
+		values = append(values, fmt.Sprintf("nice=%d", r.Nice))
+	}
+	if r.IoniceClass != "" {
+		values = append(values, "ionice="+r.IoniceClass)
+		if r.IoniceLevel != 0 {
+			values = append(values, fmt.Sprintf("ionice_level=%d", r.IoniceLevel))
+		}
+	}
+	if r.GoMaxProcs > 0 {
+		values = append(values, fmt.Sprintf("GOMAXPROCS=%d", r.GoMaxProcs))
+	}
+	if r.GoGC == -1 {
+		values = append(values, "GOGC=off")
+	} else if r.GoGC > 0 {
+		values = append(values, fmt.Sprintf("GOGC=%d", r.GoGC))
+	}
+	if r.ReadConcurrency > 0 {
+		values = append(values, fmt.Sprintf("read_concurrency=%d", r.ReadConcurrency))
+	}
+	if r.PackSize > 0 {
+		values = append(values, fmt.Sprintf("pack_size=%dMiB", r.PackSize))
+	}
+	return strings.Join(values, " ")
+}
@@ -0,0 +1,160 @@
+package Services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+type Snapshot struct {
+	Id       string           `json:"id"`
+	ShortId  string           `json:"short_id"`
+	Time     time.Time        `json:"time"`
+	Hostname string           `json:"hostname"`
+	Paths    []string         `json:"paths"`
+	Tags     []string         `json:"tags"`
+	Summary  *SnapshotSummary `json:"summary,omitempty"`
+	// Size and FileCount are the restore size of the snapshot
+	Size      int `json:"-"`
+	FileCount int `json:"-"`
+}
+
+// SnapshotSummary is only given by restic 0.17 and later.
+type SnapshotSummary struct {
+	TotalFilesProcessed int `json:"total_files_processed"`
+	TotalBytesProcessed int `json:"total_bytes_processed"`
+	DataAdded           int `json:"data_added"`
+}
+
+type SnapshotFilter struct {
+	Tags  []string
+	Paths []string
+	Since time.Time
+	Until time.Time
+}
+
+// Snapshots returns the snapshots of the repository matching the filter, oldest
+// first, with their size.
+func (bm *BackupManager) Snapshots(filter SnapshotFilter) ([]Snapshot, error) {
+	options := make([]string, 0)
+	for _, tag := range filter.Tags {
+		options = append(options, "--tag="+tag)
+	}
+	for _, path := range filter.Paths {
+		options = append(options, "--path="+path)
+	}
+	snapshots, err := bm.listSnapshots(options...)
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := make([]Snapshot, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		if !filter.Since.IsZero() && snapshot.Time.Before(filter.Since) {
+			continue
+		}
+		if !filter.Until.IsZero() && snapshot.Time.After(filter.Until) {
+			continue
+		}
+		if err := bm.fillSnapshotSize(&snapshot); err != nil {
+			return nil, err
+		}
+		filtered = append(filtered, snapshot)
+	}
+	return filtered, nil
+}
+
+// LatestSnapshot returns the latest snapshot of the server with its size, nil
+// when the repository has no snapshot.
+func (bm *BackupManager) LatestSnapshot() (*Snapshot, error) {
+	snapshots, err := bm.listSnapshots(fmt.Sprintf("--tag=%s", bm.Config.BackupConfig.Information.ServerName))
+	if err != nil || len(snapshots) == 0 {
+		return nil, err
+	}
+	latest := snapshots[len(snapshots)-1]
+	if err := bm.fillSnapshotSize(&latest); err != nil {
+		return nil, err
+	}
+	return &latest, nil
+}
+
+func (bm *BackupManager) fillSnapshotSize(snapshot *Snapshot) error {
+	if snapshot.Summary != nil {
+		snapshot.Size = snapshot.Summary.TotalBytesProcessed
+		snapshot.FileCount = snapshot.Summary.TotalFilesProcessed
+		return nil
+	}
+	stats, err := bm.resticStats("restore-size", snapshot.Id)
+	if err != nil {
+		return err
+	}
+	snapshot.Size = stats.TotalSize
+	snapshot.FileCount = stats.TotalFileCount
+	return nil
+}
+
+// listSnapshots returns the snapshots of the repository, oldest first.
+func (bm *BackupManager) listSnapshots(options ...string) ([]Snapshot, error) {
+	cmd, envs := bm.resticCommand(createBashCommand(append([]string{"snapshots", "--json"}, options...)...))
+	var stdout bytes.Buffer
+	res, err := bm.Executor.ExecuteWithStdout(cmd, bm.commandOptions(envs), &stdout)
+	if err != nil {
+		return nil, fmt.Errorf("can't list the snapshots: %s %s", err, res.Output)
+	}
+	snapshots := make([]Snapshot, 0)
+	if err := json.Unmarshal(stdout.Bytes(), &snapshots); err != nil {
+		return nil, fmt.Errorf("can't read the snapshots: %s", err)
+	}
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		return snapshots[i].Time.Before(snapshots[j].Time)
+	})
+	return snapshots, nil
+}
+
+// findSnapshot returns the snapshot matching the id, short ids are accepted.
+func findSnapshot(snapshots []Snapshot, id string) (Snapshot, bool) {
+	for _, snapshot := range snapshots {
+		if id != "" && strings.HasPrefix(snapshot.Id, id) {
+			return snapshot, true
+		}
+	}
+	return Snapshot{}, false
+}
+
+// previousSnapshot returns the latest snapshot taken before the given one, for
+// the same host and paths.
+func previousSnapshot(snapshots []Snapshot, current Snapshot) (Snapshot, bool) {
+	var previous Snapshot
+	found := false
+	for _, snapshot := range snapshots {
+		if snapshot.Id == current.Id || !snapshot.Time.Before(current.Time) {
+			continue
+		}
+		if snapshot.Hostname != current.Hostname || !sameStrings(snapshot.Paths, current.Paths) {
+			continue
+		}
+		if !found || snapshot.Time.After(previous.Time) {
+			previous, found = snapshot, true
+		}
+	}
+	return previous, found
+}
+
+func sameStrings(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	sortedA := append([]string{}, a...)
+	sortedB := append([]string{}, b...)
+	sort.Strings(sortedA)
+	sort.Strings(sortedB)
+	for i := range sortedA {
+		if sortedA[i] != sortedB[i] {
+			return false
+		}
+	}
+	return true
+}
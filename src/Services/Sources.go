@@ -0,0 +1,107 @@
+package Services
+
+import (
+	"fmt"
+	"gobackup/src/Model"
+	"gobackup/src/Utils"
+	"strings"
+	"time"
+)
+
+// BackupSources streams every source of the job into the repository, each
+// source is a step of its own.
+func (bm *BackupManager) BackupSources() {
+	if bm.Job == nil {
+		return
+	}
+	for _, source := range bm.Job.Sources {
+		bm.backupSource(source)
+	}
+}
+
+func (bm *BackupManager) backupSource(source Model.Source) {
+	filename := source.StdinFilename()
+	result := BackupStepResult{
+		Name:      fmt.Sprintf("Backing up %s (%s)", filename, source.Type),
+		ShortName: "StartBackup-" + filename,
+	}
+	bm.logStep(&result)
+	if !bm.isLastResultSuccess() {
+		return
+	}
+	startTime := time.Now()
+
+	dump, dumpEnvs := sourceCommand(source)
+	tagOptions, tagWarnings := bm.tagOptions()
+	cmd, envs := bm.resticCommand(createBashCommand(
+		"backup",
+		"--stdin",
+		"--stdin-filename="+filename,
+		tagOptions,
+	))
+	if bm.DryRun {
+		for k, v := range envs {
+			dumpEnvs[k] = v
+		}
+		bm.dryRunResult(&result, dump+" | "+cmd, dumpEnvs)
+		return
+	}
+	bm.log().Debug(dump + " | " + cmd)
+
+	dumpOptions := bm.commandOptions(dumpEnvs)
+	dumpOptions.Shell = true
+	dumpRes, res, _ := bm.Executor.ExecutePiped(dump, dumpOptions, cmd, bm.commandOptions(envs))
+	bm.keepOutput(dumpRes, res)
+	result.Output = res.Output
+	result.Status = Success
+	if len(tagWarnings) > 0 {
+		result.Output += "\n" + strings.Join(tagWarnings, "\n") + "\n"
+	}
+
+	if snapshotId := Utils.ResticSnapshotReg.FindStringSubmatch(res.Output); len(snapshotId) == 0 {
+		result.Status = Failed
+	}
+	if res.ExitCode != 0 {
+		result.Status = Failed
+	}
+	// restic saves whatever it received, a truncated dump must fail the step
+	if dumpRes.ExitCode != 0 {
+		result.Output += fmt.Sprintf("\nDump command failed with exit code %d: %s", dumpRes.ExitCode, dumpRes.Output)
+		result.Status = Failed
+	}
+	endTime := time.Now()
+	result.Duration = endTime.Sub(startTime)
+	bm.StepResults = append(bm.StepResults, result)
+	bm.LastResult = &result
+}
+
+func sourceCommand(source Model.Source) (string, map[string]string) {
+	envs := make(map[string]string)
+	binary := source.Binary
+	switch source.Type {
+	case Model.PgDumpSource, Model.PgDumpAllSource:
+		if binary == "" {
+			binary = source.Type
+		}
+		if source.Password != "" {
+			envs["PGPASSWORD"] = source.Password
+		}
+		if source.Type == Model.PgDumpAllSource {
+			return createBashCommand(binary, source.Options), envs
+		}
+		return createBashCommand(binary, source.Options, source.Database), envs
+	case Model.MysqlDumpSource:
+		if binary == "" {
+			binary = "mysqldump"
+		}
+		if source.Password != "" {
+			envs["MYSQL_PWD"] = source.Password
+		}
+		database := source.Database
+		if database == "" {
+			database = "--all-databases"
+		}
+		return createBashCommand(binary, source.Options, database), envs
+	}
+	return source.Command, envs
+}
@@ -0,0 +1,100 @@
+package Services
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const stateFilename = "state.json"
+
+// stateMutex serializes the saves of the managers running in this process
+var stateMutex sync.Mutex
+
+// State is kept between runs in the state directory, to schedule the tasks
+// which don't run on every backup.
+type State struct {
+	Repositories map[string]*RepositoryState `json:"repositories"`
+	path         string
+	// used are the repositories of this run, the only ones saved
+	used map[string]bool
+}
+
+type RepositoryState struct {
+	LastCheck      time.Time `json:"last_check,omitempty"`
+	LastCheckSlice int       `json:"last_check_slice,omitempty"`
+	LastForget     time.Time `json:"last_forget,omitempty"`
+	LastPrune      time.Time `json:"last_prune,omitempty"`
+	LastDrill      time.Time `json:"last_drill,omitempty"`
+	LastStats      time.Time `json:"last_stats,omitempty"`
+}
+
+func LoadState(dir string) (*State, error) {
+	state := &State{
+		Repositories: make(map[string]*RepositoryState),
+		path:         filepath.Join(dir, stateFilename),
+	}
+	content, err := ioutil.ReadFile(state.path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	if err := json.Unmarshal(content, state); err != nil {
+		return state, err
+	}
+	if state.Repositories == nil {
+		state.Repositories = make(map[string]*RepositoryState)
+	}
+	return state, nil
+}
+
+func (s *State) Repository(url string) *RepositoryState {
+	if s.used == nil {
+		s.used = make(map[string]bool)
+	}
+	s.used[url] = true
+	if _, ok := s.Repositories[url]; !ok {
+		s.Repositories[url] = &RepositoryState{}
+	}
+	return s.Repositories[url]
+}
+
+// Save writes the state atomically, a crash must not leave a truncated file.
+// The repositories not used by this state are reloaded, other jobs may have
+// saved them since.
+func (s *State) Save() error {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	if current, err := LoadState(filepath.Dir(s.path)); err == nil {
+		for url, repository := range current.Repositories {
+			if !s.used[url] {
+				s.Repositories[url] = repository
+			}
+		}
+	}
+	content, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(s.path), stateFilename+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), s.path)
+}
@@ -0,0 +1,145 @@
+package Services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"gobackup/src/Utils"
+	"time"
+)
+
+// RepositoryStats is the json output of restic stats, the blob counts and the
+// compression are only given in raw-data mode.
+type RepositoryStats struct {
+	TotalSize              int     `json:"total_size"`
+	TotalFileCount         int     `json:"total_file_count"`
+	TotalBlobCount         int     `json:"total_blob_count"`
+	SnapshotsCount         int     `json:"snapshots_count"`
+	TotalUncompressedSize  int     `json:"total_uncompressed_size"`
+	CompressionRatio       float64 `json:"compression_ratio"`
+	CompressionProgress    float64 `json:"compression_progress"`
+	CompressionSpaceSaving float64 `json:"compression_space_saving"`
+}
+
+func (bm *BackupManager) resticStats(mode string, snapshotIds ...string) (RepositoryStats, error) {
+	var stats RepositoryStats
+	cmd, envs := bm.resticCommand(createBashCommand(append([]string{"stats", "--json", "--mode=" + mode}, snapshotIds...)...))
+	var stdout bytes.Buffer
+	res, err := bm.Executor.ExecuteWithStdout(cmd, bm.commandOptions(envs), &stdout)
+	if err != nil {
+		return stats, fmt.Errorf("restic stats failed: %s %s", err, res.Output)
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &stats); err != nil {
+		return stats, fmt.Errorf("can't read restic stats: %s", err)
+	}
+	return stats, nil
+}
+
+// RepositorySize sums up the raw-data and restore-size statistics.
+type RepositorySize struct {
+	StoredBytes       int     `json:"stored_bytes"`
+	UncompressedBytes int     `json:"uncompressed_bytes"`
+	RestoreBytes      int     `json:"restore_bytes"`
+	Blobs             int     `json:"blobs"`
+	Files             int     `json:"files"`
+	Snapshots         int     `json:"snapshots"`
+	CompressionRatio  float64 `json:"compression_ratio"`
+	DedupRatio        float64 `json:"dedup_ratio"`
+}
+
+// RepositoryStats computes the size of the repository. The deduplication ratio
+// compares the size of every snapshot once restored to the unique data stored.
+func (bm *BackupManager) RepositoryStats(force bool) {
+	result := BackupStepResult{
+		Name:      "Repository Statistics",
+		ShortName: "Stats",
+	}
+	bm.logStep(&result)
+	if !bm.isLastResultSuccess() {
+		return
+	}
+	repositoryState := bm.State.Repository(bm.repositoryUrl(bm.Config.Repository))
+	startTime := time.Now()
+	if !force && !Utils.IsDue(bm.Config.BackupConfig.Stats.Cadence, repositoryState.LastStats, startTime) {
+		bm.log().Info("Repository statistics not due (", bm.Config.BackupConfig.Stats.Cadence, ")")
+		return
+	}
+	if bm.DryRun {
+		cmd, envs := bm.resticCommand("stats --json --mode=raw-data")
+		bm.dryRunResult(&result, cmd, envs)
+		return
+	}
+
+	size, err := bm.repositorySize()
+	result.Status = Success
+	if err != nil {
+		// Statistics are informative, the backup is not failed
+		result.Status = Warning
+		result.Output = err.Error() + "\n"
+	} else {
+		bm.RepositorySize = size
+		result.Output = size.summary()
+		repositoryState.LastStats = startTime
+		bm.saveState()
+	}
+	endTime := time.Now()
+	result.Duration = endTime.Sub(startTime)
+	bm.StepResults = append(bm.StepResults, result)
+	bm.LastResult = &result
+}
+
+func (bm *BackupManager) repositorySize() (*RepositorySize, error) {
+	raw, err := bm.resticStats("raw-data")
+	if err != nil {
+		return nil, err
+	}
+	restore, err := bm.resticStats("restore-size")
+	if err != nil {
+		return nil, err
+	}
+	size := &RepositorySize{
+		StoredBytes:       raw.TotalSize,
+		UncompressedBytes: raw.TotalUncompressedSize,
+		RestoreBytes:      restore.TotalSize,
+		Blobs:             raw.TotalBlobCount,
+		Files:             restore.TotalFileCount,
+		Snapshots:         raw.SnapshotsCount,
+		CompressionRatio:  raw.CompressionRatio,
+	}
+	// Repositories of version 1 are not compressed, restic doesn't give the uncompressed size
+	if size.UncompressedBytes == 0 {
+		size.UncompressedBytes = size.StoredBytes
+	}
+	if size.CompressionRatio == 0 && size.StoredBytes > 0 {
+		size.CompressionRatio = float64(size.UncompressedBytes) / float64(size.StoredBytes)
+	}
+	if size.UncompressedBytes > 0 {
+		size.DedupRatio = float64(size.RestoreBytes) / float64(size.UncompressedBytes)
+	}
+	return size, nil
+}
+
+func (s *RepositorySize) summary() string {
+	return fmt.Sprintf("Stored: %s (%s uncompressed, compression ratio %.2fx)\n", Utils.HumanBytes(s.StoredBytes), Utils.HumanBytes(s.UncompressedBytes), s.CompressionRatio) +
+		fmt.Sprintf("Restore size: %s of %d files in %d snapshots (deduplication ratio %.2fx)\n", Utils.HumanBytes(s.RestoreBytes), s.Files, s.Snapshots, s.DedupRatio) +
+		fmt.Sprintf("Blobs: %d\n", s.Blobs)
+}
+
+func (bm *BackupManager) getStatsMetrics(defaultLabels *Utils.PrometheusLabels) []string {
+	if bm.RepositorySize == nil {
+		return nil
+	}
+	labels := &[]Utils.PrometheusLabels{
+		Utils.MergeMap(nil, *defaultLabels),
+	}
+	return []string{
+		Utils.CreatePrometheusMetric("repository_stored_bytes", labels, []int{bm.RepositorySize.StoredBytes}),
+		Utils.CreatePrometheusMetric("repository_uncompressed_bytes", labels, []int{bm.RepositorySize.UncompressedBytes}),
+		Utils.CreatePrometheusMetric("repository_restore_bytes", labels, []int{bm.RepositorySize.RestoreBytes}),
+		Utils.CreatePrometheusMetric("repository_blobs", labels, []int{bm.RepositorySize.Blobs}),
+		Utils.CreatePrometheusMetric("repository_files", labels, []int{bm.RepositorySize.Files}),
+		// Metrics are integers, ratios are given in percent
+		Utils.CreatePrometheusMetric("repository_compression_ratio_percent", labels, []int{int(bm.RepositorySize.CompressionRatio * 100)}),
+		Utils.CreatePrometheusMetric("repository_dedup_ratio_percent", labels, []int{int(bm.RepositorySize.DedupRatio * 100)}),
+	}
+}
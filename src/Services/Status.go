@@ -0,0 +1,96 @@
+package Services
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	HealthOk      = "ok"
+	HealthWarning = "warning"
+	HealthStale   = "stale"
+	HealthError   = "error"
+)
+
+type RepositoryStatus struct {
+	Repository     string        `json:"repository"`
+	Health         string        `json:"health"`
+	LatestSnapshot *Snapshot     `json:"latest_snapshot,omitempty"`
+	AgeSeconds     int           `json:"age_seconds"`
+	LastRun        *HistoryEntry `json:"last_run,omitempty"`
+	Size           int           `json:"size"`
+	Locks          int           `json:"locks"`
+	Retention      []string      `json:"retention"`
+	Errors         []string      `json:"errors,omitempty"`
+}
+
+// Status returns the health of the repository: stale when the latest snapshot
+// is older than maxAge, warning when the last run did not succeed or the
+// repository is locked.
+func (bm *BackupManager) Status(history []HistoryEntry, maxAge time.Duration, now time.Time) RepositoryStatus {
+	status := RepositoryStatus{
+		Repository: bm.Config.Repository,
+		Retention:  bm.retentionPolicy(),
+		Errors:     make([]string, 0),
+	}
+	if lastRun, ok := LastRun(history, bm.Config.Repository); ok {
+		status.LastRun = &lastRun
+	}
+
+	snapshots, err := bm.listSnapshots(fmt.Sprintf("--tag=%s", bm.Config.BackupConfig.Information.ServerName))
+	if err != nil {
+		status.Errors = append(status.Errors, err.Error())
+	} else if len(snapshots) > 0 {
+		status.LatestSnapshot = &snapshots[len(snapshots)-1]
+		status.AgeSeconds = int(now.Sub(status.LatestSnapshot.Time).Seconds())
+	}
+	if stats, err := bm.resticStats("raw-data"); err != nil {
+		status.Errors = append(status.Errors, err.Error())
+	} else {
+		status.Size = stats.TotalSize
+	}
+	if locks, err := bm.locks(); err != nil {
+		status.Errors = append(status.Errors, err.Error())
+	} else {
+		status.Locks = len(locks)
+	}
+
+	switch {
+	case len(status.Errors) > 0:
+		status.Health = HealthError
+	case status.LatestSnapshot == nil || time.Duration(status.AgeSeconds)*time.Second > maxAge:
+		status.Health = HealthStale
+	case status.LastRun != nil && status.LastRun.Status != Success.String(), status.Locks > 0:
+		status.Health = HealthWarning
+	default:
+		status.Health = HealthOk
+	}
+	return status
+}
+
+// locks returns the ids of the locks of the repository, without locking it.
+func (bm *BackupManager) locks() ([]string, error) {
+	cmd, envs := bm.resticCommand("--no-lock list locks")
+	var stdout bytes.Buffer
+	res, err := bm.Executor.ExecuteWithStdout(cmd, bm.commandOptions(envs), &stdout)
+	if err != nil {
+		return nil, fmt.Errorf("can't list the locks: %s %s", err, res.Output)
+	}
+	return strings.Fields(stdout.String()), nil
+}
+
+func (bm *BackupManager) retentionPolicy() []string {
+	policy := make([]string, 0)
+	for _, option := range bm.Config.BackupConfig.ResticOptions {
+		if strings.HasPrefix(option, "--keep") {
+			policy = append(policy, option)
+		}
+	}
+	for _, rule := range bm.Config.BackupConfig.JobRetention(bm.Job).Rules {
+		policy = append(policy, fmt.Sprintf("[%s]", strings.Join(rule.Tags, ",")))
+		policy = append(policy, rule.Keep...)
+	}
+	return policy
+}
@@ -0,0 +1,170 @@
+package Services
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"gobackup/src/Model"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// hookTagPrefix marks the lines of the pre_backup hooks giving a tag
+const hookTagPrefix = "GOBACKUP_TAG="
+
+type tagData struct {
+	Job        string
+	Repository string
+	Host       string
+	Date       string
+	Time       string
+}
+
+// renderTags renders once the tags of the snapshots of this run: the server
+// name and the tags of the job, before the pre_backup hooks add theirs. The
+// tags failing to render are skipped, with a warning in the backup step.
+func (bm *BackupManager) renderTags() {
+	if bm.tags != nil {
+		return
+	}
+	bm.tags = []string{bm.Config.BackupConfig.Information.ServerName}
+	if bm.Job == nil {
+		return
+	}
+	for _, tag := range bm.Job.Tags {
+		value, err := bm.renderTag(tag)
+		if err != nil {
+			bm.tagWarnings = append(bm.tagWarnings, fmt.Sprintf("Tag '%s' skipped: %s", tag, err))
+			bm.log().Warning("Tag '", tag, "' skipped: ", err)
+			continue
+		}
+		bm.tags = appendTag(bm.tags, value)
+	}
+}
+
+// tagOptions returns the --tag and --host options of restic backup, with the
+// warnings of the tags not reported yet.
+func (bm *BackupManager) tagOptions() (string, []string) {
+	bm.renderTags()
+	warnings := bm.tagWarnings
+	bm.tagWarnings = nil
+	options := make([]string, 0, len(bm.tags)+1)
+	for _, tag := range bm.tags {
+		options = append(options, "--tag="+tag)
+	}
+	if host := bm.snapshotHost(); host != "" {
+		options = append(options, "--host="+host)
+	}
+	return strings.Join(options, " "), warnings
+}
+
+func (bm *BackupManager) snapshotHost() string {
+	if bm.Host != "" {
+		return bm.Host
+	}
+	if bm.Job != nil {
+		return bm.Job.Host
+	}
+	return ""
+}
+
+func (bm *BackupManager) renderTag(tag string) (string, error) {
+	tmpl, err := Model.ParseTag(tag)
+	if err != nil {
+		return "", err
+	}
+	tmpl.Funcs(template.FuncMap{
+		"date":    bm.StartTime.Format,
+		"env":     os.Getenv,
+		"git":     bm.gitCommit,
+		"command": bm.tagCommand,
+	})
+	data := tagData{
+		Repository: bm.Config.Repository,
+		Host:       bm.snapshotHost(),
+		Date:       bm.StartTime.Format("2006-01-02"),
+		Time:       bm.StartTime.Format("150405"),
+	}
+	if bm.Job != nil {
+		data.Job = bm.Job.Name
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// gitCommit returns the short commit of the repository, a placeholder in
+// dry-run as the command isn't executed.
+func (bm *BackupManager) gitCommit(dir string) (string, error) {
+	if bm.DryRun {
+		return "<git:" + dir + ">", nil
+	}
+	return bm.tagCommand(createBashCommand("git", "-C", dir, "rev-parse", "--short", "HEAD"))
+}
+
+// tagCommand returns the first line of the output of the command, a
+// placeholder in dry-run as the command isn't executed.
+func (bm *BackupManager) tagCommand(command string) (string, error) {
+	if bm.DryRun {
+		return "<command:" + command + ">", nil
+	}
+	options := bm.commandOptions(nil)
+	options.Shell = true
+	res, err := bm.Executor.Execute(command, options)
+	if err != nil {
+		return "", fmt.Errorf("%s: %s", command, strings.TrimSpace(err.Error()+" "+res.Stderr()))
+	}
+	line := strings.TrimSpace(strings.SplitN(strings.TrimSpace(res.Stdout()), "\n", 2)[0])
+	if line == "" {
+		return "", fmt.Errorf("%s: empty output", command)
+	}
+	return line, nil
+}
+
+// parseHookTags adds the tags printed by a pre_backup hook.
+func (bm *BackupManager) parseHookTags(stdout string) {
+	bm.renderTags()
+	scanner := bufio.NewScanner(strings.NewReader(stdout))
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); strings.HasPrefix(line, hookTagPrefix) {
+			bm.tags = appendTag(bm.tags, strings.TrimPrefix(line, hookTagPrefix))
+		}
+	}
+}
+
+// appendTag adds the tag once, spaces and commas can't be part of a tag.
+func appendTag(tags []string, tag string) []string {
+	tag = strings.Trim(strings.NewReplacer(" ", "-", ",", "-", "\t", "-").Replace(strings.TrimSpace(tag)), "-")
+	if tag == "" {
+		return tags
+	}
+	for _, t := range tags {
+		if t == tag {
+			return tags
+		}
+	}
+	return append(tags, tag)
+}
+
+// forgetOptions returns the options of every restic forget to run: one per
+// retention rule on the snapshots with its tags, then the policy on the
+// other snapshots.
+func (bm *BackupManager) forgetOptions(policy []string) [][]string {
+	server := bm.Config.BackupConfig.Information.ServerName
+	retention := bm.Config.BackupConfig.JobRetention(bm.Job)
+	var groupBy []string
+	if retention.GroupBy != "" {
+		groupBy = []string{"--group-by=" + retention.GroupBy}
+	}
+	commands := make([][]string, 0, len(retention.Rules)+1)
+	last := append(append([]string{}, policy...), "--tag="+server)
+	for _, rule := range retention.Rules {
+		options := append(append([]string{}, rule.Keep...), "--tag="+strings.Join(append([]string{server}, rule.Tags...), ","))
+		commands = append(commands, append(options, groupBy...))
+		last = append(last, "--keep-tag="+strings.Join(rule.Tags, ","))
+	}
+	return append(commands, append(last, groupBy...))
+}
@@ -0,0 +1,43 @@
+package Services
+
+import (
+	"gobackup/src/Utils"
+	"testing"
+)
+
+func TestTagsDryRun(t *testing.T) {
+	bm, executor := newTestManager(t, "", []Utils.ScriptRule{{Match: `.`, Stdout: "1a2b3c4\n"}})
+	bm.Job.Tags = []string{"production", `commit-{{git "/srv/app"}}`, `v{{command "cat /srv/app/VERSION"}}`}
+	bm.DryRun = true
+
+	options, warnings := bm.tagOptions()
+	if expected := "--tag=web1 --tag=production --tag=commit-<git:/srv/app> --tag=v<command:cat-/srv/app/VERSION>"; options != expected {
+		t.Errorf("options '%s', expected '%s'", options, expected)
+	}
+	if len(warnings) > 0 {
+		t.Errorf("unexpected warnings %v", warnings)
+	}
+	if calls := executor.Calls(); len(calls) > 0 {
+		t.Errorf("commands run in dry-run: %v", calls)
+	}
+}
+
+func TestTagsCommands(t *testing.T) {
+	bm, executor := newTestManager(t, "", []Utils.ScriptRule{
+		{Match: `^git -C /srv/app rev-parse --short HEAD$`, Stdout: "1a2b3c4\n"},
+		{Match: `^cat /srv/app/VERSION$`, Stdout: "2.4.1\nignored\n"},
+		{Match: `^false$`, ExitCode: 1},
+	})
+	bm.Job.Tags = []string{`commit-{{git "/srv/app"}}`, `v{{command "cat /srv/app/VERSION"}}`, `{{command "false"}}`}
+
+	options, warnings := bm.tagOptions()
+	if expected := "--tag=web1 --tag=commit-1a2b3c4 --tag=v2.4.1"; options != expected {
+		t.Errorf("options '%s', expected '%s'", options, expected)
+	}
+	if len(warnings) != 1 {
+		t.Errorf("warnings %v, expected one for the failing command", warnings)
+	}
+	if calls := executor.Calls(); len(calls) != 3 {
+		t.Errorf("commands %v, expected 3", calls)
+	}
+}
@@ -0,0 +1,141 @@
+package Utils
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ValidatePattern checks an exclusion pattern the way restic does, a leading
+// ! negates the pattern and ** matches any number of folders.
+func ValidatePattern(pattern string) error {
+	p := strings.TrimPrefix(pattern, "!")
+	if strings.TrimSpace(p) == "" {
+		return fmt.Errorf("empty pattern")
+	}
+	for _, part := range strings.Split(filepath.ToSlash(p), "/") {
+		if part == "**" {
+			continue
+		}
+		if _, err := filepath.Match(part, ""); err != nil {
+			return fmt.Errorf("invalid pattern '%s': %s", pattern, err)
+		}
+	}
+	return nil
+}
+
+// ReadPatternFile returns the patterns of an exclusion file: the empty lines
+// and the comments are skipped, the environment variables are expanded.
+func ReadPatternFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	patterns := make([]string, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, os.ExpandEnv(line))
+	}
+	return patterns, scanner.Err()
+}
+
+// Pattern is an exclusion pattern matched like restic: a pattern starting
+// with / is anchored at the root, the other ones match at any depth, and a
+// path is matched when the pattern matches it or one of its parent folders.
+type Pattern struct {
+	Original    string
+	Negated     bool
+	insensitive bool
+	parts       []string
+}
+
+func ParsePattern(pattern string, insensitive bool) Pattern {
+	p := Pattern{Original: pattern, insensitive: insensitive}
+	if strings.HasPrefix(pattern, "!") {
+		p.Negated = true
+		pattern = pattern[1:]
+	}
+	if insensitive {
+		pattern = strings.ToLower(pattern)
+	}
+	p.parts = splitPath(filepath.Clean(pattern))
+	return p
+}
+
+func (p Pattern) Match(path string) bool {
+	if p.insensitive {
+		path = strings.ToLower(path)
+	}
+	return matchParts(p.parts, splitPath(filepath.Clean(path)))
+}
+
+// MatchPatterns tells if the path is excluded by the patterns, and which
+// pattern excluded it. A negated pattern includes back the paths matched by
+// the previous patterns.
+func MatchPatterns(patterns []Pattern, path string) (bool, int) {
+	matched, index := false, -1
+	for i, pattern := range patterns {
+		if !pattern.Match(path) {
+			continue
+		}
+		if pattern.Negated {
+			matched, index = false, -1
+		} else if !matched {
+			matched, index = true, i
+		}
+	}
+	return matched, index
+}
+
+func splitPath(path string) []string {
+	parts := strings.Split(filepath.ToSlash(path), "/")
+	if parts[0] == "" {
+		parts[0] = "/"
+	}
+	return parts
+}
+
+func matchParts(pattern []string, parts []string) bool {
+	for pos, part := range pattern {
+		if part != "**" {
+			continue
+		}
+		// ** is expanded to zero, one or more folders
+		for i := 0; i <= len(parts)-len(pattern)+1; i++ {
+			expanded := append([]string{}, pattern[:pos]...)
+			for j := 0; j < i; j++ {
+				expanded = append(expanded, "*")
+			}
+			if matchParts(append(expanded, pattern[pos+1:]...), parts) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(pattern) == 0 || len(pattern) > len(parts) {
+		return false
+	}
+	minOffset, maxOffset := 0, len(parts)-len(pattern)
+	if pattern[0] == "/" {
+		maxOffset = 0
+	} else if parts[0] == "/" {
+		minOffset = 1
+	}
+	for offset := maxOffset; offset >= minOffset; offset-- {
+		matched := true
+		for i := len(pattern) - 1; i >= 0 && matched; i-- {
+			matched, _ = filepath.Match(pattern[i], parts[offset+i])
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
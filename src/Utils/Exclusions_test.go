@@ -0,0 +1,84 @@
+package Utils
+
+import "testing"
+
+func TestPatternMatch(t *testing.T) {
+	for _, test := range []struct {
+		pattern     string
+		insensitive bool
+		path        string
+		expected    bool
+	}{
+		// Not anchored patterns match at any depth, and the content of the matched folders
+		{"*.iso", false, "/home/alice/disk.iso", true},
+		{"*.iso", false, "/home/alice/disk.iso.txt", false},
+		{"node_modules", false, "/srv/app/node_modules", true},
+		{"node_modules", false, "/srv/app/node_modules/lib/index.js", true},
+		{"app/node_modules", false, "/srv/app/node_modules", true},
+		{"app/node_modules", false, "/srv/other/node_modules", false},
+		// Anchored patterns only match from the root
+		{"/srv/app", false, "/srv/app/main.go", true},
+		{"/app", false, "/srv/app", false},
+		{"/home/*/Downloads", false, "/home/alice/Downloads/film.mkv", true},
+		{"/home/*/Downloads", false, "/home/alice/work/Downloads", false},
+		// ** matches zero, one or more folders
+		{"/home/**/.cache", false, "/home/.cache", true},
+		{"/home/**/.cache", false, "/home/alice/.cache", true},
+		{"/home/**/.cache", false, "/home/alice/work/app/.cache/data", true},
+		{"/home/**/.cache", false, "/var/alice/.cache", false},
+		{"**/build/*.o", false, "/src/lib/build/main.o", true},
+		{"**/build/*.o", false, "/src/lib/build/main.c", false},
+		// Case
+		{"*.ISO", false, "/data/disk.iso", false},
+		{"*.ISO", true, "/data/disk.iso", true},
+		{"/Data/*.iso", true, "/data/DISK.ISO", true},
+	} {
+		if matched := ParsePattern(test.pattern, test.insensitive).Match(test.path); matched != test.expected {
+			t.Errorf("'%s' matching '%s': %v, expected %v", test.pattern, test.path, matched, test.expected)
+		}
+	}
+}
+
+func TestMatchPatterns(t *testing.T) {
+	patterns := []Pattern{
+		ParsePattern("/var/log/*", false),
+		ParsePattern("!/var/log/app", false),
+		ParsePattern("*.gz", false),
+		ParsePattern("/var/log/*.log", false),
+	}
+	for _, test := range []struct {
+		path     string
+		excluded bool
+		index    int
+	}{
+		{"/var/log/syslog", true, 0},
+		{"/var/log/app", false, -1},
+		{"/var/log/app/access.log", false, -1},
+		// A pattern after the negated one excludes again
+		{"/var/log/app/access.log.gz", true, 2},
+		{"/var/log/kern.log", true, 0},
+		{"/srv/data.gz", true, 2},
+		{"/srv/data", false, -1},
+	} {
+		excluded, index := MatchPatterns(patterns, test.path)
+		if excluded != test.excluded || index != test.index {
+			t.Errorf("'%s': excluded %v by %d, expected %v by %d", test.path, excluded, index, test.excluded, test.index)
+		}
+	}
+}
+
+func TestValidatePattern(t *testing.T) {
+	for pattern, valid := range map[string]bool{
+		"*.iso":           true,
+		"!/var/log/app":   true,
+		"/home/**/.cache": true,
+		"[a-z]*.tmp":      true,
+		"[a-z*.tmp":       false,
+		"!":               false,
+		"  ":              false,
+	} {
+		if err := ValidatePattern(pattern); (err == nil) != valid {
+			t.Errorf("'%s': error %v, expected valid %v", pattern, err, valid)
+		}
+	}
+}
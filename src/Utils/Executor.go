@@ -0,0 +1,175 @@
+package Utils
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Executor runs the commands of a backup, on this host, on a remote host or in
+// a container. The commands are split on spaces, unless options.Shell is set.
+type Executor interface {
+	Execute(command string, options CommandOptions) (CommandResult, error)
+	// ExecuteWithStdout writes the standard output into stdout, see ExecuteCommandWithStdout
+	ExecuteWithStdout(command string, options CommandOptions, stdout io.Writer) (CommandResult, error)
+	// ExecutePiped streams the output of source into command, see ExecutePipedCommands
+	ExecutePiped(source string, sourceOptions CommandOptions, command string, options CommandOptions) (CommandResult, CommandResult, error)
+}
+
+// commandSpec is the local process running a command: its arguments, its
+// environment variables and what is written first on its standard input.
+type commandSpec struct {
+	args  []string
+	envs  map[string]string
+	stdin string
+}
+
+type commandWrapper func(args []string, envs map[string]string) (commandSpec, error)
+
+func localCommand(args []string, envs map[string]string) (commandSpec, error) {
+	return commandSpec{args: args, envs: envs}, nil
+}
+
+// processExecutor runs the commands through a local process built by wrap.
+type processExecutor struct {
+	wrap commandWrapper
+}
+
+func (e processExecutor) Execute(command string, options CommandOptions) (CommandResult, error) {
+	return executeCommand(e.wrap, command, options)
+}
+
+func (e processExecutor) ExecuteWithStdout(command string, options CommandOptions, stdout io.Writer) (CommandResult, error) {
+	return executeWithStdout(e.wrap, command, options, stdout)
+}
+
+func (e processExecutor) ExecutePiped(source string, sourceOptions CommandOptions, command string, options CommandOptions) (CommandResult, CommandResult, error) {
+	return executePiped(e.wrap, source, sourceOptions, command, options)
+}
+
+type LocalExecutor struct {
+	processExecutor
+}
+
+func NewLocalExecutor() *LocalExecutor {
+	return &LocalExecutor{processExecutor{localCommand}}
+}
+
+// SSHExecutor runs the commands on a remote host with ssh. The environment
+// variables are sent on the standard input, they never appear in the command
+// lines, so the remote shell must be a POSIX shell.
+type SSHExecutor struct {
+	processExecutor
+	Host         string
+	Port         int
+	IdentityFile string
+	// Options are given to ssh with -o, like StrictHostKeyChecking=yes
+	Options []string
+	Binary  string
+}
+
+func NewSSHExecutor(host string, port int, identityFile string, options []string, binary string) *SSHExecutor {
+	if binary == "" {
+		binary = "ssh"
+	}
+	e := &SSHExecutor{Host: host, Port: port, IdentityFile: identityFile, Options: options, Binary: binary}
+	e.wrap = e.command
+	return e
+}
+
+// The remote shell reads the variables until an empty line, the rest of the
+// standard input is left to the command.
+const sshEnvScript = `while IFS= read -r line && [ -n "$line" ]; do export "$line"; done; exec`
+
+func (e *SSHExecutor) command(args []string, envs map[string]string) (commandSpec, error) {
+	sshArgs := []string{e.Binary, "-o", "BatchMode=yes"}
+	if e.Port != 0 {
+		sshArgs = append(sshArgs, "-p", strconv.Itoa(e.Port))
+	}
+	if e.IdentityFile != "" {
+		sshArgs = append(sshArgs, "-i", e.IdentityFile)
+	}
+	for _, option := range e.Options {
+		sshArgs = append(sshArgs, "-o", option)
+	}
+
+	var stdin strings.Builder
+	for _, name := range sortedKeys(envs) {
+		if strings.ContainsAny(envs[name], "\n\r") {
+			return commandSpec{}, fmt.Errorf("the variable %s can't be sent over ssh, it contains a line break", name)
+		}
+		stdin.WriteString(name + "=" + envs[name] + "\n")
+	}
+	stdin.WriteString("\n")
+
+	quoted := make([]string, 0, len(args))
+	for _, arg := range args {
+		quoted = append(quoted, ShellQuote(arg))
+	}
+	remote := sshEnvScript + " " + strings.Join(quoted, " ")
+	return commandSpec{args: append(sshArgs, e.Host, remote), stdin: stdin.String()}, nil
+}
+
+// DockerExecutor runs the commands in a running container with docker exec,
+// or podman exec. The environment variables are given to docker by name, their
+// values stay in the environment of the docker process.
+type DockerExecutor struct {
+	processExecutor
+	Container string
+	User      string
+	Binary    string
+}
+
+func NewDockerExecutor(container string, user string, binary string) *DockerExecutor {
+	if binary == "" {
+		binary = "docker"
+	}
+	e := &DockerExecutor{Container: container, User: user, Binary: binary}
+	e.wrap = e.command
+	return e
+}
+
+func (e *DockerExecutor) command(args []string, envs map[string]string) (commandSpec, error) {
+	dockerArgs := []string{e.Binary, "exec", "-i"}
+	if e.User != "" {
+		dockerArgs = append(dockerArgs, "-u", e.User)
+	}
+	for _, name := range sortedKeys(envs) {
+		dockerArgs = append(dockerArgs, "-e", name)
+	}
+	dockerArgs = append(dockerArgs, e.Container)
+	return commandSpec{args: append(dockerArgs, args...), envs: envs}, nil
+}
+
+// FailingExecutor fails every command, when the executor of a job can't be created.
+type FailingExecutor struct {
+	Err error
+}
+
+func (e FailingExecutor) Execute(string, CommandOptions) (CommandResult, error) {
+	return CommandResult{ExitCode: -1, Output: e.Err.Error()}, e.Err
+}
+
+func (e FailingExecutor) ExecuteWithStdout(string, CommandOptions, io.Writer) (CommandResult, error) {
+	return CommandResult{ExitCode: -1, Output: e.Err.Error()}, e.Err
+}
+
+func (e FailingExecutor) ExecutePiped(string, CommandOptions, string, CommandOptions) (CommandResult, CommandResult, error) {
+	return CommandResult{ExitCode: -1}, CommandResult{ExitCode: -1, Output: e.Err.Error()}, e.Err
+}
+
+// ShellQuote quotes the value for a POSIX shell.
+func ShellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,14 @@
+package Utils
+
+// Exit codes of the backup command, documented in the Readme.
+const (
+	ExitSuccess = 0
+	// ExitBackup is also used for the unexpected errors
+	ExitBackup       = 1
+	ExitConfig       = 2
+	ExitPreflight    = 3
+	ExitHook         = 4
+	ExitPartial      = 5
+	ExitMaintenance  = 6
+	ExitNotification = 7
+)
@@ -2,12 +2,55 @@ package Utils
 
 import (
 	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
 	"github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"path/filepath"
 	"sync"
+	"time"
 )
 
 var logger *logrus.Logger
 
+var (
+	logFields      = logrus.Fields{}
+	logFieldsMutex sync.RWMutex
+	logOutput      io.Writer = os.Stderr
+)
+
+type LoggingOptions struct {
+	// Format is text or json
+	Format string
+	Level  string
+	// Destination is stdout, stderr or file
+	Destination string
+	File        string
+	MaxSize     int64
+	MaxAge      time.Duration
+	MaxBackups  int
+}
+
+// fieldsHook adds the fields of the run (run id, job, step) to every line.
+type fieldsHook struct{}
+
+func (h fieldsHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h fieldsHook) Fire(entry *logrus.Entry) error {
+	logFieldsMutex.RLock()
+	defer logFieldsMutex.RUnlock()
+	for k, v := range logFields {
+		if _, ok := entry.Data[k]; !ok {
+			entry.Data[k] = v
+		}
+	}
+	return nil
+}
+
 func InitLogger(configLogLevel *string) *logrus.Logger {
 	var once sync.Once
 	once.Do(func() {
@@ -20,10 +63,97 @@ func InitLogger(configLogLevel *string) *logrus.Logger {
 		}
 		logger.SetLevel(logLevel)
 		logger.SetFormatter(&logrus.TextFormatter{FullTimestamp: true})
+		logger.AddHook(fieldsHook{})
+		SetLogField("run_id", newRunId())
 	})
 	return logger
 }
 
+// GetLogger returns the logger of the command line, or the standard logger of
+// logrus when gobackup is used as a library.
 func GetLogger() *logrus.Logger {
+	if logger == nil {
+		return logrus.StandardLogger()
+	}
 	return logger
 }
+
+// ConfigureLogger applies the logging section of the configuration, the
+// logger is created when InitLogger has not been called.
+func ConfigureLogger(options LoggingOptions) error {
+	if logger == nil {
+		level := logrus.InfoLevel.String()
+		InitLogger(&level)
+	}
+	if options.Level != "" {
+		level, err := logrus.ParseLevel(options.Level)
+		if err != nil {
+			return err
+		}
+		logger.SetLevel(level)
+	}
+	if options.Format == "json" {
+		logger.SetFormatter(&logrus.JSONFormatter{})
+	} else {
+		logger.SetFormatter(&logrus.TextFormatter{FullTimestamp: true})
+	}
+
+	switch options.Destination {
+	case "stdout":
+		logOutput = os.Stdout
+	case "file":
+		file, err := OpenRotatingFile(options.File, options.MaxSize, options.MaxAge, options.MaxBackups)
+		if err != nil {
+			return err
+		}
+		logOutput = file
+	default:
+		logOutput = os.Stderr
+	}
+	logger.SetOutput(logOutput)
+	return nil
+}
+
+// StartRunLog copies the logs of this run into their own file of the directory,
+// the files older than maxAge are removed. The path of the file is returned.
+func StartRunLog(dir string, name string, maxAge time.Duration) (string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	if maxAge > 0 {
+		removeOlderFiles(filepath.Join(dir, "*.log"), time.Now().Add(-maxAge))
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%s-%s-%s.log", time.Now().Format("20060102-150405"), name, RunId()))
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", err
+	}
+	GetLogger().SetOutput(io.MultiWriter(logOutput, f))
+	return path, nil
+}
+
+// SetLogField adds a field to the following lines, an empty value removes it.
+func SetLogField(key string, value string) {
+	logFieldsMutex.Lock()
+	defer logFieldsMutex.Unlock()
+	if value == "" {
+		delete(logFields, key)
+		return
+	}
+	logFields[key] = value
+}
+
+func RunId() string {
+	logFieldsMutex.RLock()
+	defer logFieldsMutex.RUnlock()
+	id, _ := logFields["run_id"].(string)
+	return id
+}
+
+func newRunId() string {
+	id := make([]byte, 6)
+	if _, err := rand.Read(id); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,29 @@
+package Utils
+
+import (
+	"github.com/sirupsen/logrus"
+	"os"
+	"testing"
+)
+
+func TestConfigureLoggerWithoutInit(t *testing.T) {
+	previous, previousOutput := logger, logOutput
+	defer func() { logger, logOutput = previous, previousOutput }()
+	logger = nil
+
+	if err := ConfigureLogger(LoggingOptions{Level: "debug", Format: "json", Destination: "stdout"}); err != nil {
+		t.Fatal(err)
+	}
+	if logger == nil || GetLogger() != logger {
+		t.Fatal("the logger is not created")
+	}
+	if logger.GetLevel() != logrus.DebugLevel || logger.Out != os.Stdout {
+		t.Errorf("unexpected level %s or output", logger.GetLevel())
+	}
+	if _, ok := logger.Formatter.(*logrus.JSONFormatter); !ok {
+		t.Errorf("unexpected formatter %T", logger.Formatter)
+	}
+	if err := ConfigureLogger(LoggingOptions{Level: "loud"}); err == nil {
+		t.Error("an invalid level is accepted")
+	}
+}
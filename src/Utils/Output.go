@@ -0,0 +1,187 @@
+package Utils
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	StdoutStream = "stdout"
+	StderrStream = "stderr"
+)
+
+type OutputLine struct {
+	Time   time.Time
+	Stream string
+	Text   string
+}
+
+func (l OutputLine) String() string {
+	return fmt.Sprintf("%s [%s] %s", l.Time.Format("2006-01-02T15:04:05.000Z07:00"), l.Stream, l.Text)
+}
+
+// outputCapture keeps the first and the last lines of each stream, within
+// maxLines, the lines in between are only counted. Once lines are skipped, the
+// whole output is written to a file of dir, with the timestamps.
+type outputCapture struct {
+	mutex    sync.Mutex
+	name     string
+	logger   logrus.FieldLogger
+	maxLines int
+	dir      string
+	streams  map[string]*streamLines
+	file     *os.File
+	filename string
+	// spillFailed stops the retries once the output couldn't be saved
+	spillFailed bool
+}
+
+type streamLines struct {
+	head    []OutputLine
+	tail    []OutputLine
+	skipped int
+}
+
+func newOutputCapture(name string, options CommandOptions) *outputCapture {
+	return &outputCapture{
+		name:     name,
+		logger:   options.logger(),
+		maxLines: options.MaxOutputLines,
+		dir:      options.OutputDir,
+		streams:  make(map[string]*streamLines),
+	}
+}
+
+func (c *outputCapture) add(stream string, text string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	line := OutputLine{Time: time.Now(), Stream: stream, Text: text}
+	if c.file != nil {
+		_, _ = fmt.Fprintln(c.file, line.String())
+	}
+	lines, ok := c.streams[stream]
+	if !ok {
+		lines = &streamLines{}
+		c.streams[stream] = lines
+	}
+	if c.maxLines <= 0 || len(lines.head) < (c.maxLines+1)/2 {
+		lines.head = append(lines.head, line)
+		return
+	}
+	lines.tail = append(lines.tail, line)
+	if len(lines.tail) > c.maxLines/2 {
+		if c.file == nil && !c.spillFailed {
+			c.spill()
+		}
+		lines.tail = lines.tail[1:]
+		lines.skipped++
+	}
+}
+
+// spill writes every line added so far, the following lines are written when added.
+func (c *outputCapture) spill() {
+	if c.dir == "" {
+		return
+	}
+	if err := os.MkdirAll(c.dir, 0700); err != nil {
+		c.logger.Warning("Impossible to save the output of ", c.name, ": ", err)
+		c.spillFailed = true
+		return
+	}
+	f, err := ioutil.TempFile(c.dir, fmt.Sprintf("%s-%s-%s-*.log", time.Now().Format("20060102-150405"), RunId(), c.name))
+	if err != nil {
+		c.logger.Warning("Impossible to save the output of ", c.name, ": ", err)
+		c.spillFailed = true
+		return
+	}
+	// Nothing was skipped yet, the lines kept are all the lines
+	for _, line := range c.lines() {
+		_, _ = fmt.Fprintln(f, line.String())
+	}
+	c.file, c.filename = f, f.Name()
+}
+
+// lines returns the lines kept of every stream, in the order they were read.
+func (c *outputCapture) lines() []OutputLine {
+	var all []OutputLine
+	for _, lines := range c.streams {
+		all = append(all, lines.head...)
+		all = append(all, lines.tail...)
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].Time.Before(all[j].Time) })
+	return all
+}
+
+func (c *outputCapture) close() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.file != nil {
+		_ = c.file.Close()
+	}
+}
+
+func (c *outputCapture) result(result *CommandResult) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	result.Lines = c.lines()
+	result.LogFile = c.filename
+
+	texts := make([]string, 0, len(result.Lines)+len(c.streams))
+	markers := make(map[string]bool)
+	for _, line := range result.Lines {
+		lines := c.streams[line.Stream]
+		if lines.skipped > 0 && !markers[line.Stream] && len(lines.tail) > 0 && line == lines.tail[0] {
+			markers[line.Stream] = true
+			texts = append(texts, c.marker(line.Stream, lines.skipped))
+		}
+		texts = append(texts, line.Text)
+	}
+	for _, stream := range []string{StdoutStream, StderrStream} {
+		if lines, ok := c.streams[stream]; ok && lines.skipped > 0 {
+			result.Skipped += lines.skipped
+			if !markers[stream] {
+				texts = append(texts, c.marker(stream, lines.skipped))
+			}
+		}
+	}
+	result.Output = strings.Join(texts, "\n")
+}
+
+func (c *outputCapture) marker(stream string, skipped int) string {
+	if c.filename != "" {
+		return fmt.Sprintf("[... %d %s lines skipped, full output in %s ...]", skipped, stream, c.filename)
+	}
+	return fmt.Sprintf("[... %d %s lines skipped ...]", skipped, stream)
+}
+
+// read adds every line of the stream to the capture and to the debug logs,
+// until the stream is closed. Lines too long for the scanner are cut.
+func (c *outputCapture) read(wg *sync.WaitGroup, reader io.Reader, stream string) {
+	defer wg.Done()
+	entry := c.logger.WithField("command", c.name).WithField("stream", stream)
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		c.add(stream, scanner.Text())
+		entry.Debug(scanner.Text())
+	}
+	if scanner.Err() != nil {
+		c.add(stream, "[line too long, output truncated]")
+		// The command must not be blocked on a full pipe
+		_, _ = io.Copy(ioutil.Discard, reader)
+	}
+}
+
+// RemoveOldOutputs removes the outputs saved in the directory before the time.
+func RemoveOldOutputs(dir string, before time.Time) {
+	removeOlderFiles(filepath.Join(dir, "*.log"), before)
+}
@@ -1,6 +1,9 @@
 package Utils
 
-import "regexp"
+import (
+	"regexp"
+	"strconv"
+)
 
 var DefaultResticOptions = []string{
 	"--keep-daily=90",
@@ -15,34 +18,47 @@ var (
 	ResticProcessedReg   = regexp.MustCompile(`processed ([0-9.]*) files, ([0-9.]+) (\w+)`)
 	ResticKeptSnapsReg   = regexp.MustCompile(`keep ([0-9.]*) snapshots:`)
 	ResticRemoveSnapsReg = regexp.MustCompile(`remove ([0-9.]*) snapshots:`)
+
+	ResticPruneTotalReg     = regexp.MustCompile(`total prune:\s+([0-9]+) blobs / ([0-9.]+) (B|KiB|MiB|GiB|TiB)`)
+	ResticPruneRepackReg    = regexp.MustCompile(`to repack:\s+([0-9]+) blobs / ([0-9.]+) (B|KiB|MiB|GiB|TiB)`)
+	ResticPruneRemainingReg = regexp.MustCompile(`remaining:\s+([0-9]+) blobs / ([0-9.]+) (B|KiB|MiB|GiB|TiB)`)
 )
 
 type ResticStats struct {
-	FilesNew         int
-	FilesChanged     int
-	FilesUnmodified  int
-	FilesProcessed   int
-	DirsNew          int
-	DirsChanged      int
-	DirsUnmodified   int
-	AddedToRepo      int
-	BytesAdded       int
-	BytesProcessed   int
-	KeptSnapshots    int
-	RemovedSnapshots int
+	SnapshotId       string `json:"snapshot_id"`
+	FilesNew         int    `json:"files_new"`
+	FilesChanged     int    `json:"files_changed"`
+	FilesUnmodified  int    `json:"files_unmodified"`
+	FilesProcessed   int    `json:"files_processed"`
+	DirsNew          int    `json:"dirs_new"`
+	DirsChanged      int    `json:"dirs_changed"`
+	DirsUnmodified   int    `json:"dirs_unmodified"`
+	AddedToRepo      int    `json:"added_to_repo"`
+	BytesAdded       int    `json:"bytes_added"`
+	BytesProcessed   int    `json:"bytes_processed"`
+	KeptSnapshots    int    `json:"kept_snapshots"`
+	RemovedSnapshots int    `json:"removed_snapshots"`
+	PrunedBlobs      int    `json:"pruned_blobs"`
+	PrunedBytes      int    `json:"pruned_bytes"`
+	RepackedBytes    int    `json:"repacked_bytes"`
+	RemainingBytes   int    `json:"remaining_bytes"`
 }
 
-func ConvertUnitRate(amount int, unit string) int {
-	var result int64
+// ParseSize converts a size printed by restic, like "1.234 MiB", to bytes.
+func ParseSize(amount string, unit string) int {
+	value, err := strconv.ParseFloat(amount, 64)
+	if err != nil {
+		return 0
+	}
 	switch unit {
 	case "TiB":
-		result = int64(amount) * (1 << 40)
+		value *= 1 << 40
 	case "GiB":
-		result = int64(amount) * (1 << 30)
+		value *= 1 << 30
 	case "MiB":
-		result = int64(amount) * (1 << 20)
+		value *= 1 << 20
 	case "KiB":
-		result = int64(amount) * (1 << 10)
+		value *= 1 << 10
 	}
-	return int(result)
+	return int(value)
 }
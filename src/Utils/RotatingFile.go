@@ -0,0 +1,98 @@
+package Utils
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RotatingFile is a log file renamed with a timestamp once bigger than maxSize.
+// The rotated files older than maxAge, and beyond the maxBackups latest, are
+// removed. Zero values disable the limit.
+type RotatingFile struct {
+	path       string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+	mutex      sync.Mutex
+	file       *os.File
+	size       int64
+}
+
+func OpenRotatingFile(path string, maxSize int64, maxAge time.Duration, maxBackups int) (*RotatingFile, error) {
+	r := &RotatingFile{path: path, maxSize: maxSize, maxAge: maxAge, maxBackups: maxBackups}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	r.cleanup()
+	return r, nil
+}
+
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *RotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.file, r.size = f, info.Size()
+	return nil
+}
+
+func (r *RotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(r.path, r.path+"."+time.Now().Format("20060102-150405.000")); err != nil {
+		return err
+	}
+	if err := r.open(); err != nil {
+		return err
+	}
+	r.cleanup()
+	return nil
+}
+
+func (r *RotatingFile) cleanup() {
+	if r.maxAge > 0 {
+		removeOlderFiles(r.path+".*", time.Now().Add(-r.maxAge))
+	}
+	if r.maxBackups > 0 {
+		// The timestamp of the name keeps the rotated files sorted
+		rotated, _ := filepath.Glob(r.path + ".*")
+		sort.Strings(rotated)
+		for i := 0; i < len(rotated)-r.maxBackups; i++ {
+			_ = os.Remove(rotated[i])
+		}
+	}
+}
+
+func removeOlderFiles(pattern string, before time.Time) {
+	files, _ := filepath.Glob(pattern)
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil && info.ModTime().Before(before) {
+			_ = os.Remove(file)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package Utils
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// ScriptRule answers the commands matching Match, a regular expression.
+type ScriptRule struct {
+	Match    string `yaml:"match"`
+	Stdout   string `yaml:"stdout"`
+	Stderr   string `yaml:"stderr"`
+	ExitCode int    `yaml:"exit_code"`
+	match    *regexp.Regexp
+}
+
+// ScriptedExecutor answers the commands from a script without running them,
+// to test a configuration or the whole pipeline without restic. The first rule
+// matching a command gives its output, the other commands fail with the exit
+// code 127.
+type ScriptedExecutor struct {
+	rules []ScriptRule
+	mutex sync.Mutex
+	calls []string
+}
+
+func NewScriptedExecutor(rules []ScriptRule) (*ScriptedExecutor, error) {
+	for i := range rules {
+		match, err := regexp.Compile(rules[i].Match)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %s", i+1, err)
+		}
+		rules[i].match = match
+	}
+	return &ScriptedExecutor{rules: rules}, nil
+}
+
+// LoadScriptedExecutor reads the rules of a yaml file, a list of match,
+// stdout, stderr and exit_code.
+func LoadScriptedExecutor(filename string) (*ScriptedExecutor, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var rules []ScriptRule
+	if err := yaml.UnmarshalStrict(content, &rules); err != nil {
+		return nil, err
+	}
+	return NewScriptedExecutor(rules)
+}
+
+// Calls returns the commands received, in order.
+func (e *ScriptedExecutor) Calls() []string {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return append([]string{}, e.calls...)
+}
+
+func (e *ScriptedExecutor) Execute(command string, options CommandOptions) (CommandResult, error) {
+	rule := e.answer(command)
+	capture := newOutputCapture(commandName(command, options), options)
+	defer capture.close()
+	capture.addLines(StdoutStream, rule.Stdout)
+	capture.addLines(StderrStream, rule.Stderr)
+	return scriptedResult(capture, rule)
+}
+
+func (e *ScriptedExecutor) ExecuteWithStdout(command string, options CommandOptions, stdout io.Writer) (CommandResult, error) {
+	rule := e.answer(command)
+	if _, err := io.WriteString(stdout, rule.Stdout); err != nil {
+		return CommandResult{ExitCode: -1}, err
+	}
+	return CommandResult{ExitCode: rule.ExitCode, Output: strings.TrimSpace(rule.Stderr)}, scriptedError(rule)
+}
+
+func (e *ScriptedExecutor) ExecutePiped(source string, sourceOptions CommandOptions, command string, options CommandOptions) (CommandResult, CommandResult, error) {
+	sourceRule := e.answer(source)
+	sourceCapture := newOutputCapture(commandName(source, sourceOptions), sourceOptions)
+	defer sourceCapture.close()
+	sourceCapture.addLines(StderrStream, sourceRule.Stderr)
+	sourceResult, sourceErr := scriptedResult(sourceCapture, sourceRule)
+
+	result, err := e.Execute(command, options)
+	if err != nil {
+		return sourceResult, result, err
+	}
+	if sourceErr != nil {
+		return sourceResult, result, fmt.Errorf("source command failed: %s", sourceErr)
+	}
+	return sourceResult, result, nil
+}
+
+func (e *ScriptedExecutor) answer(command string) ScriptRule {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.calls = append(e.calls, command)
+	for _, rule := range e.rules {
+		if rule.match.MatchString(command) {
+			return rule
+		}
+	}
+	return ScriptRule{Stderr: "no scripted answer for: " + command, ExitCode: 127}
+}
+
+func (c *outputCapture) addLines(stream string, text string) {
+	if text == "" {
+		return
+	}
+	entry := c.logger.WithField("command", c.name).WithField("stream", stream)
+	for _, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		c.add(stream, line)
+		entry.Debug(line)
+	}
+}
+
+func scriptedResult(capture *outputCapture, rule ScriptRule) (CommandResult, error) {
+	var result CommandResult
+	capture.result(&result)
+	result.ExitCode = rule.ExitCode
+	return result, scriptedError(rule)
+}
+
+func scriptedError(rule ScriptRule) error {
+	if rule.ExitCode != 0 {
+		return fmt.Errorf("exit status %d", rule.ExitCode)
+	}
+	return nil
+}
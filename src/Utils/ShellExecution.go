@@ -1,56 +1,345 @@
 package Utils
 
 import (
-	"bufio"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"github.com/sirupsen/logrus"
 	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 )
 
 type CommandResult struct {
 	ExitCode int
-	Output   string
+	// Output is the standard and error outputs, one line per line of the command
+	Output string
+	Lines  []OutputLine
+	// Skipped lines are not kept in memory, they are in LogFile when OutputDir is set
+	Skipped int
+	LogFile string
+}
+
+func (r CommandResult) Stdout() string {
+	return r.stream(StdoutStream)
+}
+
+func (r CommandResult) Stderr() string {
+	return r.stream(StderrStream)
+}
+
+func (r CommandResult) stream(stream string) string {
+	texts := make([]string, 0, len(r.Lines))
+	for _, line := range r.Lines {
+		if line.Stream == stream {
+			texts = append(texts, line.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+type CommandOptions struct {
+	Envs    map[string]string
+	Timeout time.Duration
+	// Shell runs the command through "/bin/sh -c", allowing pipes and quotes
+	Shell    bool
+	Priority Priority
+	// MaxOutputLines keeps the first and last lines of the output in memory, 0 keeps everything
+	MaxOutputLines int
+	// OutputDir receives the whole output of the commands with skipped lines
+	OutputDir string
+	// Context kills the command when it is done
+	Context context.Context
+	// Logger receives the output lines, the default logger is used when nil
+	Logger logrus.FieldLogger
+}
+
+func (o CommandOptions) logger() logrus.FieldLogger {
+	if o.Logger != nil {
+		return o.Logger
+	}
+	return GetLogger()
+}
+
+// Priority runs the command through nice and ionice, zero values are not applied.
+type Priority struct {
+	Nice int
+	// IoniceClass is 1 for realtime, 2 for best-effort and 3 for idle
+	IoniceClass int
+	IoniceLevel int
+}
+
+func (p Priority) prefix() []string {
+	var args []string
+	if p.Nice != 0 {
+		args = append(args, "nice", "-n", strconv.Itoa(p.Nice))
+	}
+	if p.IoniceClass != 0 {
+		args = append(args, "ionice", "-c", strconv.Itoa(p.IoniceClass))
+		if p.IoniceLevel != 0 {
+			args = append(args, "-n", strconv.Itoa(p.IoniceLevel))
+		}
+	}
+	return args
 }
 
 func ExecuteCommand(command string) (CommandResult, error) {
-	return ExecuteCommandWithEnv(command, nil)
+	return ExecuteCommandWithOptions(command, CommandOptions{})
 }
 
 func ExecuteCommandWithEnv(command string, envs map[string]string) (CommandResult, error) {
+	return ExecuteCommandWithOptions(command, CommandOptions{Envs: envs})
+}
+
+func ExecuteCommandWithOptions(command string, options CommandOptions) (CommandResult, error) {
+	return executeCommand(localCommand, command, options)
+}
+
+func executeCommand(wrap commandWrapper, command string, options CommandOptions) (CommandResult, error) {
+	ctx, cancel := commandContext(options)
+	defer cancel()
+	cmd, err := newCommand(ctx, wrap, command, options)
+	if err != nil {
+		return CommandResult{ExitCode: -1}, err
+	}
+	return runCommand(ctx, cmd, commandName(command, options), options, nil)
+}
+
+// ExecuteCommandWithStdout writes the raw standard output of the command into
+// stdout, for binary or json outputs. Only the error output is kept in the result.
+func ExecuteCommandWithStdout(command string, options CommandOptions, stdout io.Writer) (CommandResult, error) {
+	return executeWithStdout(localCommand, command, options, stdout)
+}
+
+func executeWithStdout(wrap commandWrapper, command string, options CommandOptions, stdout io.Writer) (CommandResult, error) {
+	ctx, cancel := commandContext(options)
+	defer cancel()
+	cmd, err := newCommand(ctx, wrap, command, options)
+	if err != nil {
+		return CommandResult{ExitCode: -1}, err
+	}
+	var stderr bytes.Buffer
+	cmd.Stdout = stdout
+	cmd.Stderr = &stderr
+
+	var result CommandResult
+	err = cmd.Run()
+	result.Output = strings.TrimSpace(stderr.String())
+	if err := contextError(ctx, options); err != nil {
+		result.ExitCode = -1
+		return result, err
+	}
+	var exitError *exec.ExitError
+	if errors.As(err, &exitError) {
+		result.ExitCode = exitError.ExitCode()
+	} else if err != nil {
+		result.ExitCode = -1
+	}
+	return result, err
+}
+
+// ExecutePipedCommands streams the standard output of the source command into
+// the standard input of the command. Both results are returned, the error is
+// set when any of the two commands failed.
+func ExecutePipedCommands(source string, sourceOptions CommandOptions, command string, options CommandOptions) (CommandResult, CommandResult, error) {
+	return executePiped(localCommand, source, sourceOptions, command, options)
+}
+
+func executePiped(wrap commandWrapper, source string, sourceOptions CommandOptions, command string, options CommandOptions) (CommandResult, CommandResult, error) {
+	var sourceResult CommandResult
+	sourceCtx, sourceCancel := commandContext(sourceOptions)
+	defer sourceCancel()
+	ctx, cancel := commandContext(options)
+	defer cancel()
+
+	sourceCmd, err := newCommand(sourceCtx, wrap, source, sourceOptions)
+	if err != nil {
+		sourceResult.ExitCode = -1
+		return sourceResult, CommandResult{ExitCode: -1}, err
+	}
+	cmd, err := newCommand(ctx, wrap, command, options)
+	if err != nil {
+		sourceResult.ExitCode = -1
+		return sourceResult, CommandResult{ExitCode: -1}, err
+	}
+	sourceCapture := newOutputCapture(commandName(source, sourceOptions), sourceOptions)
+	defer sourceCapture.close()
+	sourceStderr, err := sourceCmd.StderrPipe()
+	if err != nil {
+		sourceResult.ExitCode = -1
+		return sourceResult, CommandResult{ExitCode: -1}, err
+	}
+	pipe, err := sourceCmd.StdoutPipe()
+	if err != nil {
+		sourceResult.ExitCode = -1
+		return sourceResult, CommandResult{ExitCode: -1}, err
+	}
+	if err := sourceCmd.Start(); err != nil {
+		sourceResult.ExitCode = -1
+		return sourceResult, CommandResult{ExitCode: -1}, err
+	}
+	var sourceWg sync.WaitGroup
+	sourceWg.Add(1)
+	go sourceCapture.read(&sourceWg, sourceStderr, StderrStream)
+
+	onStart := func() {
+		// The pipe is only read by the command, closing our side lets the source
+		// receive SIGPIPE if the command stops reading
+		_ = pipe.Close()
+	}
+	if cmd.Stdin != nil {
+		// The executor writes to the standard input before the pipe, it is copied by this process
+		cmd.Stdin = io.MultiReader(cmd.Stdin, pipe)
+		onStart = nil
+	} else {
+		cmd.Stdin = pipe
+	}
+	result, err := runCommand(ctx, cmd, commandName(command, options), options, onStart)
+	_ = pipe.Close()
+	if err != nil {
+		_ = sourceCmd.Process.Kill()
+	}
+
+	sourceWg.Wait()
+	sourceErr := sourceCmd.Wait()
+	sourceCapture.result(&sourceResult)
+	var exitError *exec.ExitError
+	if errors.As(sourceErr, &exitError) {
+		sourceResult.ExitCode = exitError.ExitCode()
+	} else if sourceErr != nil {
+		sourceResult.ExitCode = -1
+	}
+
+	if err != nil {
+		return sourceResult, result, err
+	}
+	if sourceErr != nil {
+		return sourceResult, result, fmt.Errorf("source command failed: %s", sourceErr)
+	}
+	return sourceResult, result, nil
+}
+
+func commandContext(options CommandOptions) (context.Context, context.CancelFunc) {
+	parent := options.Context
+	if parent == nil {
+		parent = context.Background()
+	}
+	if options.Timeout > 0 {
+		return context.WithTimeout(parent, options.Timeout)
+	}
+	return context.WithCancel(parent)
+}
+
+// contextError returns why the command was killed, if it was.
+func contextError(ctx context.Context, options CommandOptions) error {
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		if options.Context != nil && options.Context.Err() == context.DeadlineExceeded {
+			return errors.New("command stopped, the deadline of the run is exceeded")
+		}
+		return fmt.Errorf("command timed out after %s", options.Timeout)
+	case context.Canceled:
+		return errors.New("command canceled")
+	}
+	return nil
+}
+
+// killable commands run in their own process group, to kill the children holding the output pipes.
+func (o CommandOptions) killable() bool {
+	return o.Timeout > 0 || o.Context != nil
+}
+
+func newCommand(ctx context.Context, wrap commandWrapper, command string, options CommandOptions) (*exec.Cmd, error) {
 	trimmed := strings.TrimSpace(command)
-	parts := strings.Split(trimmed, " ")
-	cmd := exec.Command(parts[0], parts[1:]...)
+	args := options.Priority.prefix()
+	if options.Shell {
+		args = append(args, "/bin/sh", "-c", trimmed)
+	} else {
+		args = append(args, strings.Fields(trimmed)...)
+	}
+	spec, err := wrap(args, options.Envs)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.CommandContext(ctx, spec.args[0], spec.args[1:]...)
 
-	if envs != nil {
+	if spec.envs != nil {
 		cmd.Env = os.Environ()
-		for k, v := range envs {
+		for k, v := range spec.envs {
 			cmd.Env = append(cmd.Env, k+"="+v+"")
 		}
 	}
+	if spec.stdin != "" {
+		cmd.Stdin = strings.NewReader(spec.stdin)
+	}
+	if options.killable() {
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	}
+	return cmd, nil
+}
+
+// commandName is the name of the binary, given with the output lines in the logs.
+func commandName(command string, options CommandOptions) string {
+	parts := strings.Fields(command)
+	if options.Shell || len(parts) == 0 {
+		return "sh"
+	}
+	return filepath.Base(parts[0])
+}
+
+func runCommand(ctx context.Context, cmd *exec.Cmd, name string, options CommandOptions, onStart func()) (CommandResult, error) {
 	var result CommandResult
+	capture := newOutputCapture(name, options)
+	defer capture.close()
 	stderr, _ := cmd.StderrPipe()
 	stdout, _ := cmd.StdoutPipe()
-	scanner := bufio.NewScanner(io.MultiReader(stdout, stderr))
 
 	err := cmd.Start()
+	if onStart != nil {
+		onStart()
+	}
 	if err != nil {
-		result.Output = scanner.Text()
-		if exitError, ok := err.(*exec.ExitError); ok {
-			result.ExitCode = exitError.ExitCode()
-			return result, err
-		}
+		result.ExitCode = -1
+		return result, err
 	}
-
-	for scanner.Scan() {
-		m := scanner.Text()
-		result.Output += m
-		fmt.Println(m)
+	if options.killable() {
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			select {
+			case <-ctx.Done():
+				_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+			case <-done:
+			}
+		}()
 	}
-	cmd.Wait()
 
+	// Both outputs are read at the same time, a full stderr pipe would block the command
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go capture.read(&wg, stdout, StdoutStream)
+	go capture.read(&wg, stderr, StderrStream)
+	wg.Wait()
+	err = cmd.Wait()
+	capture.result(&result)
+
+	if err := contextError(ctx, options); err != nil {
+		result.ExitCode = -1
+		return result, err
+	}
+	var exitError *exec.ExitError
+	if errors.As(err, &exitError) {
+		result.ExitCode = exitError.ExitCode()
+		return result, err
+	}
 	result.ExitCode = 0
 
-	return result, nil
+	return result, err
 }
@@ -5,6 +5,8 @@ import (
 	"github.com/sirupsen/logrus"
 	"math/bits"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -20,14 +22,18 @@ func MergeMap(options PrometheusLabels, defaultOptions PrometheusLabels) Prometh
 	return options
 }
 
-func HaltOnError(logger *logrus.Logger, err error, message string) {
+func HaltOnError(logger logrus.FieldLogger, err error, message string) {
+	HaltWithCode(logger, err, message, ExitBackup)
+}
+
+func HaltWithCode(logger logrus.FieldLogger, err error, message string, code int) {
 	if err != nil {
 		logger.Error(message + "\n=> " + err.Error())
-		os.Exit(1)
+		os.Exit(code)
 	}
 }
 
-func WarnOnError(logger *logrus.Logger, err error, message string, callback func()) {
+func WarnOnError(logger logrus.FieldLogger, err error, message string, callback func()) {
 	if err != nil {
 		logger.Warning(message + "\n" + err.Error())
 		if callback != nil {
@@ -36,11 +42,38 @@ func WarnOnError(logger *logrus.Logger, err error, message string, callback func
 	}
 }
 
+func MaskSecrets(text string, secrets []string) string {
+	for _, secret := range secrets {
+		if secret != "" {
+			text = strings.ReplaceAll(text, secret, "********")
+		}
+	}
+	return text
+}
+
 func StartOfDay(datetime time.Time) time.Time {
 	year, month, day := datetime.Date()
 	return time.Date(year, month, day, 0, 0, 0, 0, datetime.Location())
 }
 
+// IsDue tells if a task with this cadence, last done at last, must run now.
+// Daily and weekly cadences are aligned on the start of the day, so a task
+// done at night is due again the next night even if it started a bit earlier.
+func IsDue(cadence string, last time.Time, now time.Time) bool {
+	if last.IsZero() {
+		return cadence != "never"
+	}
+	switch cadence {
+	case "never":
+		return false
+	case "daily":
+		return !StartOfDay(now).Before(StartOfDay(last).AddDate(0, 0, 1))
+	case "weekly":
+		return !StartOfDay(now).Before(StartOfDay(last).AddDate(0, 0, 7))
+	}
+	return true
+}
+
 func contains(haystack []string, needle string) bool {
 	for _, v := range haystack {
 		if v == needle {
@@ -65,6 +98,54 @@ func compareArrays(old []string, new []string) []string {
 	return tagsChanges
 }
 
+func HumanBytes(bytes int) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	value := float64(bytes)
+	i := 0
+	for value >= 1024 && i < len(units)-1 {
+		value /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	return fmt.Sprintf("%.2f %s", value, units[i])
+}
+
+// ParseDuration accepts the Go durations (26h, 90m) and a number of days (7d).
+func ParseDuration(value string) (time.Duration, error) {
+	if strings.HasSuffix(value, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration '%s'", value)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(value)
+}
+
+// ParseTime accepts a date, a date and time, RFC 3339, or a duration in the
+// past (7d). A date alone ends at the end of the day when endOfDay is set.
+func ParseTime(value string, now time.Time, endOfDay bool) (time.Time, error) {
+	if duration, err := ParseDuration(value); err == nil {
+		return now.Add(-duration), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02 15:04", value, time.Local); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return t, fmt.Errorf("invalid date '%s', expected 2006-01-02, 2006-01-02 15:04 or a duration (7d)", value)
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return t, nil
+}
+
 func HumanDuration(seconds float64) string {
 	secondsInDay := uint64((time.Hour * 24).Seconds())
 	secondsInHour := uint64((time.Hour).Seconds())
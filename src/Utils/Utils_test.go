@@ -0,0 +1,45 @@
+package Utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIsDue(t *testing.T) {
+	at := func(value string) time.Time {
+		date, err := time.ParseInLocation("2006-01-02 15:04", value, time.Local)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return date
+	}
+	for _, test := range []struct {
+		cadence  string
+		last     string
+		now      string
+		expected bool
+	}{
+		{"always", "2024-05-02 01:00", "2024-05-02 01:05", true},
+		{"", "2024-05-02 01:00", "2024-05-02 01:05", true},
+		{"never", "", "2024-05-02 01:05", false},
+		{"never", "2024-01-01 00:00", "2024-05-02 01:05", false},
+		// A task which never ran is due
+		{"daily", "", "2024-05-02 01:05", true},
+		{"weekly", "", "2024-05-02 01:05", true},
+		// daily is due once per calendar day, whatever the hour
+		{"daily", "2024-05-02 01:00", "2024-05-02 23:59", false},
+		{"daily", "2024-05-01 23:59", "2024-05-02 00:01", true},
+		{"daily", "2024-05-01 01:00", "2024-05-03 01:00", true},
+		// weekly is due seven days after the day of the last run
+		{"weekly", "2024-05-02 23:00", "2024-05-08 23:59", false},
+		{"weekly", "2024-05-02 23:00", "2024-05-09 00:01", true},
+	} {
+		var last time.Time
+		if test.last != "" {
+			last = at(test.last)
+		}
+		if due := IsDue(test.cadence, last, at(test.now)); due != test.expected {
+			t.Errorf("%s, last run '%s', on %s: due %v, expected %v", test.cadence, test.last, test.now, due, test.expected)
+		}
+	}
+}